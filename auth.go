@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AuthDump is the content of auth.json written by --dump-auth: the users and
+// user-defined roles of the backed up database, for manual recreation.
+// Credentials are never requested, so no password hashes are stored.
+type AuthDump struct {
+	DB    string            `json:"db"`
+	Users []json.RawMessage `json:"users"`
+	Roles []json.RawMessage `json:"roles"`
+}
+
+// dumpAuth reads users and custom roles with usersInfo/rolesInfo. It needs
+// the viewUser and viewRole actions on the database (e.g. the userAdmin role).
+func dumpAuth(ctx context.Context, db *mongo.Database) (AuthDump, error) {
+	out := AuthDump{DB: db.Name(), Users: []json.RawMessage{}, Roles: []json.RawMessage{}}
+
+	var users struct {
+		Users []bson.Raw `bson:"users"`
+	}
+	if err := db.RunCommand(ctx, bson.D{{Key: "usersInfo", Value: 1}}).Decode(&users); err != nil {
+		return AuthDump{}, authCommandError("usersInfo", "viewUser", err)
+	}
+	var roles struct {
+		Roles []bson.Raw `bson:"roles"`
+	}
+	cmd := bson.D{{Key: "rolesInfo", Value: 1}, {Key: "showPrivileges", Value: true}, {Key: "showBuiltinRoles", Value: false}}
+	if err := db.RunCommand(ctx, cmd).Decode(&roles); err != nil {
+		return AuthDump{}, authCommandError("rolesInfo", "viewRole", err)
+	}
+
+	for _, u := range users.Users {
+		ext, err := bson.MarshalExtJSON(u, false, false)
+		if err != nil {
+			return AuthDump{}, err
+		}
+		out.Users = append(out.Users, ext)
+	}
+	for _, r := range roles.Roles {
+		ext, err := bson.MarshalExtJSON(r, false, false)
+		if err != nil {
+			return AuthDump{}, err
+		}
+		out.Roles = append(out.Roles, ext)
+	}
+	return out, nil
+}
+
+// authCommandError names the missing privilege when the server refused the
+// command (code 13, Unauthorized).
+func authCommandError(cmd, action string, err error) error {
+	var ce mongo.CommandError
+	if errors.As(err, &ce) && ce.Code == 13 {
+		return fmt.Errorf("%s: %w (requires the %s privilege on the database)", cmd, err, action)
+	}
+	return fmt.Errorf("%s: %w", cmd, err)
+}
+
+// authPath returns where auth.json lives for a given output, next to the
+// manifest.
+func authPath(output string, isDir bool) string {
+	if isDir {
+		return filepath.Join(output, "auth.json")
+	}
+	return outputStem(output) + ".auth.json"
+}
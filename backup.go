@@ -0,0 +1,710 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// backupRun holds the settings and shared state of one backup invocation.
+type backupRun struct {
+	db     *mongo.Database
+	dbName string
+	output string
+	isDir  bool
+	merged io.Writer // merged output; nil in directory mode
+
+	// jsonArray makes the merged output a single JSON array (a .json
+	// target) instead of JSON Lines; arrayDocs counts elements written.
+	jsonArray bool
+	arrayDocs int
+
+	filter          bson.M // server-side Find filter applied to every collection
+	projection      bson.M // --fields projection; nil = whole documents
+	batchSize       int
+	pretty          bool
+	canonical       bool // canonical instead of relaxed Extended JSON
+	fieldOrder      bool // sort keys at every depth (--canonical-field-order)
+	numsAsStrings   bool // unsafe int64/Decimal128 as JSON strings; BSON copy keeps types
+	dropList        []string
+	dropRe          *regexp.Regexp // --drop-fields-regex; nil = off
+	recursive       bool           // dropRe also applies to nested documents
+	redact          [][]string     // --redact dotted paths, split on "."
+	maxFieldBytes   int64
+	heartbeat       time.Duration
+	quiet           bool // --quiet: no progress lines on stderr
+	countCheck      bool
+	maxDrift        float64 // max % count change while a collection is read; 0 = off
+	abortIfChanging bool    // exceeding maxDrift fails the run instead of warning
+	dumpStats       bool
+	docTimeout      time.Duration
+	noCursorTimeout bool
+	fileIndex       bool
+	indexes         bool        // write <db>.<coll>.indexes.json (off with --no-indexes)
+	fsync           bool        // Sync each file after its final flush
+	gzip            bool        // compress the JSON output (--gzip)
+	gzipLevel       int         // gzip.NewWriterLevel level
+	writeBSON       bool        // also write <db>.<coll>.bson (--format jsonl,bson)
+	writeCSV        bool        // also write <db>.<coll>.csv (--format jsonl,csv)
+	csvColumns      []string    // fixed CSV columns; nil = union of all keys
+	verifyRoundtrip bool        // re-parse every document and report lossy fields
+	nameEncoding    string      // collection names in file names: percent or none
+	fileMode        os.FileMode // exact mode of created files; 0 = default
+
+	// pipeline, when set, replaces Find with an aggregation on the
+	// collection (--pipeline/--source-collection).
+	pipeline     bson.A
+	pipelineJSON string
+	allowDiskUse bool
+	hint         interface{} // index name (string) or key spec (bson.D)
+
+	tolerate map[string]bool // collections whose errors are logged and skipped
+
+	compressThreads int // --compress-threads: gzip workers per output file
+
+	excludeIndexes map[string]bool // --exclude-index: index names left out of the specs
+
+	// sinceLast reads in _id order and records each collection's max _id;
+	// afterIDs holds the max _id of the previous backup (--since-last-backup).
+	sinceLast bool
+	afterIDs  map[string]interface{}
+
+	// limitTotal caps documents across all collections; totalDocs counts
+	// documents written so far (by every --parallel worker).
+	limitTotal int64
+	totalDocs  atomic.Int64
+
+	specs    map[string]*mongo.CollectionSpecification
+	progress *progressTracker
+	bar      *progressBar
+	disk     *diskGuard
+	lag      *lagGuard
+
+	reconnect *reconnector // --on-network-error reconnect; nil = fail
+	split     *dateSplit   // --output-split-by-date; nil = one file
+}
+
+// backupCollection writes one collection and returns its manifest entry. The
+// collection's file is always flushed and closed before returning, so an
+// aborted run leaves complete documents on disk.
+func (r *backupRun) backupCollection(ctx context.Context, collName string, index int) (entry CollectionManifest, err error) {
+	if err := r.disk.check(collName); err != nil {
+		return entry, err
+	}
+
+	coll := r.db.Collection(collName)
+	// Views cannot be counted from metadata; they get no progress lines.
+	spec := r.specs[collName]
+	showLines := !r.quiet && r.bar == nil && (spec == nil || spec.Type != "view")
+	var startCount int64
+	if r.progress != nil || r.bar != nil || r.maxDrift > 0 || showLines {
+		total, err := coll.EstimatedDocumentCount(ctx)
+		if err != nil {
+			return entry, fmt.Errorf("count %s: %w", collName, err)
+		}
+		startCount = total
+		if r.progress != nil || r.bar != nil {
+			r.progress.startCollection(collName, index, total)
+			r.bar.start(collName, total)
+			defer r.bar.finish()
+		}
+	}
+	var lines *progressLine
+	if showLines {
+		total := startCount
+		if r.pipeline != nil {
+			total = 0 // the source count says nothing about the pipeline's output
+		}
+		lines = newProgressLine(collName, total)
+	}
+	findOpts := options.Find().SetBatchSize(int32(r.batchSize))
+	if r.allowDiskUse {
+		findOpts.SetAllowDiskUse(true)
+	}
+	if r.noCursorTimeout {
+		findOpts.SetNoCursorTimeout(true)
+	}
+	if r.hint != nil {
+		findOpts.SetHint(r.hint)
+	}
+	if r.projection != nil {
+		findOpts.SetProjection(r.projection)
+	}
+	if r.docTimeout > 0 || r.sinceLast || r.reconnect != nil {
+		// Reopening after the last _id is only correct in _id order, and
+		// the last _id written is the max one to resume from next time.
+		findOpts.SetSort(bson.D{{Key: "_id", Value: 1}})
+	}
+
+	filter := r.filter
+	openCursor := func(after interface{}) (*mongo.Cursor, error) {
+		f := filter
+		if after != nil {
+			f = afterIDFilter(filter, after)
+		}
+		if r.limitTotal > 0 {
+			findOpts.SetLimit(r.limitTotal - r.totalDocs.Load())
+		}
+		cur, err := coll.Find(ctx, f, findOpts)
+		for r.reconnect.lost(ctx, err) {
+			if err = r.rebuildClient(ctx, err); err != nil {
+				return nil, err
+			}
+			coll = r.db.Collection(collName)
+			cur, err = coll.Find(ctx, f, findOpts)
+		}
+		return cur, err
+	}
+	var cur *mongo.Cursor
+	if r.pipeline != nil {
+		aggOpts := options.Aggregate().SetBatchSize(int32(r.batchSize))
+		if r.allowDiskUse {
+			aggOpts.SetAllowDiskUse(true)
+		}
+		if r.hint != nil {
+			aggOpts.SetHint(r.hint)
+		}
+		cur, err = coll.Aggregate(ctx, r.pipeline, aggOpts)
+		if err != nil {
+			return entry, fmt.Errorf("aggregate %s%s: %w", collName, r.hintNote(), err)
+		}
+	} else if cur, err = openCursor(r.afterIDs[collName]); err != nil {
+		return entry, fmt.Errorf("find %s%s: %w", collName, r.hintNote(), err)
+	}
+	defer func() { closeCursor(cur) }()
+
+	var w io.Writer
+	var bsonW io.Writer // raw BSON tee, nil unless --format includes bson
+	var csvOut *csvSink // flattened CSV, nil unless --format includes csv
+	var outName string
+
+	var parts *partitionSet // per-period files, nil unless --output-split-by-date
+	if r.isDir && r.split != nil {
+		parts = newPartitionSet(r.output, func(bucket string) string {
+			return r.collFileName(collName, "."+bucket+r.jsonExt())
+		}, r.fileMode, r.fsync)
+		parts.gzip, parts.gzipLevel, parts.compressThreads = r.gzip, r.gzipLevel, r.compressThreads
+		defer func() {
+			list, cerr := parts.close()
+			if cerr != nil && err == nil {
+				err = cerr
+			}
+			// Also set on failure, so a tolerated error can remove them.
+			entry.Partitions = list
+		}()
+		fmt.Printf("Backing up %s -> %s (split by %s)\n", collName, filepath.Join(r.output, r.collFileName(collName, ".<period>"+r.jsonExt())), r.split.period)
+	} else if r.isDir {
+		outName = r.collFileName(collName, r.jsonExt())
+		path := filepath.Join(r.output, outName)
+		f, cerr := createFile(path, r.fileMode)
+		if cerr != nil {
+			return entry, cerr
+		}
+		var sum hash.Hash
+		onDisk := &countingWriter{w: f}
+		if r.fileIndex {
+			sum = sha256.New()
+			onDisk.w = io.MultiWriter(f, sum)
+		}
+		bw := bufio.NewWriterSize(onDisk, 1<<20)
+		var zw io.WriteCloser
+		if r.gzip {
+			if zw, cerr = newGzipWriter(bw, r.gzipLevel, r.compressThreads); cerr != nil {
+				_ = f.Close()
+				return entry, cerr
+			}
+		}
+		defer func() {
+			// The gzip trailer goes through bw, so it is closed first.
+			if zw != nil {
+				if zerr := zw.Close(); zerr != nil && err == nil {
+					err = zerr
+				}
+			}
+			if ferr := bw.Flush(); ferr != nil && err == nil {
+				err = ferr
+			}
+			if r.fsync && err == nil {
+				err = f.Sync()
+			}
+			if cerr := f.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+			if err == nil {
+				entry.Bytes = onDisk.n
+				if sum != nil {
+					entry.SHA256 = hex.EncodeToString(sum.Sum(nil))
+				}
+			}
+		}()
+		w = bw
+		if zw != nil {
+			w = zw
+		}
+		fmt.Printf("Backing up %s -> %s\n", collName, path)
+
+		if r.writeBSON {
+			bsonName := r.collFileName(collName, ".bson")
+			bf, cerr := createFile(filepath.Join(r.output, bsonName), r.fileMode)
+			if cerr != nil {
+				return entry, cerr
+			}
+			bbw := bufio.NewWriterSize(bf, 1<<20)
+			defer func() {
+				if ferr := bbw.Flush(); ferr != nil && err == nil {
+					err = ferr
+				}
+				if r.fsync && err == nil {
+					err = bf.Sync()
+				}
+				if cerr := bf.Close(); cerr != nil && err == nil {
+					err = cerr
+				}
+				if err == nil {
+					entry.BSONFile = bsonName
+				}
+			}()
+			bsonW = bbw
+		}
+
+		if r.writeCSV {
+			csvName := r.collFileName(collName, ".csv")
+			sink, cerr := newCSVSink(filepath.Join(r.output, csvName), r.csvColumns, r.fileMode)
+			if cerr != nil {
+				return entry, cerr
+			}
+			defer func() {
+				if cerr := sink.close(err != nil, r.fsync); cerr != nil && err == nil {
+					err = fmt.Errorf("csv %s: %w", collName, cerr)
+				}
+				if err == nil {
+					entry.CSVFile = csvName
+				}
+			}()
+			csvOut = sink
+		}
+	} else {
+		// merged output
+		outName = filepath.Base(r.output)
+		w = r.merged
+		fmt.Printf("Backing up %s -> (merged)\n", collName)
+	}
+	cw := &countingWriter{w: w}
+	w = cw
+	collStart := time.Now()
+
+	var beat <-chan time.Time
+	if r.heartbeat > 0 {
+		t := time.NewTicker(r.heartbeat)
+		defer t.Stop()
+		beat = t.C
+	}
+
+	count := 0
+	defer func() {
+		// A failed or interrupted collection still reports what it wrote.
+		if err != nil {
+			entry.Docs, entry.written = int64(count), cw.n
+		}
+	}()
+	var largeDropped int64
+	var regexDropped int64
+	var redacted int64
+	var mismatches int64
+	var stringified int64
+	lastID := r.afterIDs[collName]
+	stalls := 0
+	for {
+		if !r.nextDoc(ctx, cur) {
+			if cerr := cur.Err(); r.reconnect.lost(ctx, cerr) {
+				closeCursor(cur)
+				if err := r.rebuildClient(ctx, cerr); err != nil {
+					return entry, fmt.Errorf("cursor %s: %w", collName, err)
+				}
+				coll = r.db.Collection(collName)
+				fmt.Printf("Resuming %s after _id %v\n", collName, lastID)
+				if cur, err = openCursor(lastID); err != nil {
+					return entry, fmt.Errorf("find %s: %w", collName, err)
+				}
+				continue
+			}
+			if !r.stalled(ctx, cur) {
+				break
+			}
+			stalls++
+			if stalls > docTimeoutRetries {
+				return entry, fmt.Errorf("cursor %s: no document within --doc-timeout %s after %d retries", collName, r.docTimeout, docTimeoutRetries)
+			}
+			fmt.Printf("Cursor on %s stalled for more than %s; reopening after _id %v (retry %d/%d)\n",
+				collName, r.docTimeout, lastID, stalls, docTimeoutRetries)
+			closeCursor(cur)
+			if cur, err = openCursor(lastID); err != nil {
+				return entry, fmt.Errorf("find %s: %w", collName, err)
+			}
+			continue
+		}
+		stalls = 0
+		r.reconnect.ok()
+
+		select {
+		case <-beat:
+			fmt.Printf("still backing up %s... (%d docs)\n", collName, count)
+		default:
+		}
+		if err := r.disk.check(collName); err != nil {
+			return entry, err
+		}
+		if err := r.lag.wait(ctx); err != nil {
+			return entry, err
+		}
+
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			return entry, fmt.Errorf("decode %s: %w", collName, err)
+		}
+
+		lastID = doc["_id"]
+		var bucket string
+		if parts != nil {
+			// Before --drop-fields, which may remove the time field.
+			bucket = r.split.bucket(doc)
+		}
+
+		modified := false
+		for _, f := range r.dropList {
+			if _, ok := doc[f]; ok {
+				delete(doc, f)
+				modified = true
+			}
+		}
+		for _, p := range r.redact {
+			if _, n := redactPath(doc, p); n > 0 {
+				redacted += n
+				modified = true
+			}
+		}
+		if r.dropRe != nil {
+			if n := dropMatchingFields(doc, r.dropRe, r.recursive); n > 0 {
+				regexDropped += n
+				modified = true
+			}
+		}
+		if r.maxFieldBytes > 0 {
+			if n := dropLargeFields(doc, r.maxFieldBytes); n > 0 {
+				largeDropped += n
+				modified = true
+			}
+		}
+
+		// Add metadata when merged (optional but handy)
+		if !r.isDir {
+			doc["_meta"] = bson.M{"db": r.dbName, "collection": collName}
+		}
+
+		jsonDoc := doc
+		if r.numsAsStrings {
+			var n int
+			jsonDoc, n = stringifyNumbers(doc)
+			stringified += int64(n)
+		}
+		extJSON, err := r.marshalDoc(jsonDoc)
+		if err != nil {
+			return entry, fmt.Errorf("marshal %s: %w", collName, err)
+		}
+
+		if r.verifyRoundtrip {
+			path, err := roundtripDiff(jsonDoc, extJSON, r.canonical)
+			if err != nil {
+				return entry, fmt.Errorf("verify %s: %w", collName, err)
+			}
+			if path != "" {
+				mismatches++
+				fmt.Fprintf(os.Stderr, "Roundtrip mismatch in %s: _id %v, field %s\n", collName, doc["_id"], path)
+			}
+		}
+		if parts != nil {
+			if cw.w, err = parts.forDoc(bucket); err != nil {
+				return entry, err
+			}
+		}
+		if err := r.writeDoc(w, extJSON); err != nil {
+			return entry, err
+		}
+		if csvOut != nil {
+			if err := csvOut.write(jsonDoc); err != nil {
+				return entry, fmt.Errorf("csv %s: %w", collName, err)
+			}
+		}
+		if bsonW != nil {
+			// Unmodified documents are copied verbatim to keep field order,
+			// unless --canonical-field-order asks for sorted keys.
+			raw := []byte(cur.Current)
+			if modified || r.fieldOrder {
+				var v interface{} = doc
+				if r.fieldOrder {
+					v = sortedFields(doc)
+				}
+				if raw, err = bson.Marshal(v); err != nil {
+					return entry, fmt.Errorf("marshal %s: %w", collName, err)
+				}
+			}
+			if _, err := bsonW.Write(raw); err != nil {
+				return entry, err
+			}
+		}
+		count++
+		r.totalDocs.Add(1)
+		r.progress.add(1)
+		r.bar.add(1)
+		lines.add(1)
+		if r.limitReached() {
+			break
+		}
+	}
+
+	r.bar.finish()
+
+	if err := cur.Err(); err != nil {
+		return entry, fmt.Errorf("cursor %s: %w", collName, err)
+	}
+
+	entry = CollectionManifest{Name: collName, File: outName, Docs: int64(count), LargeFieldsDropped: largeDropped, RegexFieldsDropped: regexDropped, RoundtripMismatches: mismatches, NumbersStringified: stringified, FieldsRedacted: redacted}
+	if r.pipeline != nil {
+		entry.Pipeline = json.RawMessage(r.pipelineJSON)
+	}
+	if spec != nil {
+		v, err := validatorFromOptions(spec.Options)
+		if err != nil {
+			return entry, fmt.Errorf("validator %s: %w", collName, err)
+		}
+		entry.Validator = v
+		if entry.Options, err = creationOptions(spec.Options); err != nil {
+			return entry, fmt.Errorf("options %s: %w", collName, err)
+		}
+		if preAndPostImages(spec.Options) {
+			entry.PrePostImages = true
+			fmt.Fprintf(os.Stderr, "Warning: %s has changeStreamPreAndPostImages enabled; the setting is recorded in the manifest options (a restore must recreate the collection with them), but existing pre/post images are not backed up\n", collName)
+		}
+	}
+	if r.indexes && r.pipeline == nil {
+		if entry.Indexes, entry.ExcludedIndexes, err = r.writeIndexes(ctx, coll); err != nil {
+			return entry, fmt.Errorf("indexes %s: %w", collName, err)
+		}
+	}
+	if r.sinceLast && lastID != nil {
+		// With no new documents the previous max carries forward.
+		if entry.MaxID, err = encodeMaxID(lastID); err != nil {
+			return entry, fmt.Errorf("max _id %s: %w", collName, err)
+		}
+	}
+	entry.written = cw.n
+	if r.dumpStats {
+		entry.Stats = newCollectionStats(entry.Docs, cw.n, time.Since(collStart))
+	}
+	if r.countCheck && r.limitReached() {
+		// --limit-total cut the collection short: a shortfall says nothing
+		// about concurrent writes.
+		fmt.Printf("Skipping count check of %s: --limit-total reached\n", collName)
+	} else if r.countCheck {
+		// Count what the cursor selected: with --since-last-backup that is
+		// only the documents after the previous backup's max _id.
+		countFilter := filter
+		if after := r.afterIDs[collName]; after != nil {
+			countFilter = afterIDFilter(filter, after)
+		}
+		live, err := coll.CountDocuments(ctx, countFilter)
+		if err != nil {
+			return entry, fmt.Errorf("count check %s: %w", collName, err)
+		}
+		entry.CountCheck = &CountCheck{Live: live, Difference: live - entry.Docs}
+		if live != entry.Docs {
+			fmt.Printf("Warning: %s changed during backup: wrote %d docs, collection now has %d\n", collName, entry.Docs, live)
+		}
+	}
+	if r.maxDrift > 0 {
+		end, err := coll.EstimatedDocumentCount(ctx)
+		if err != nil {
+			return entry, fmt.Errorf("drift count %s: %w", collName, err)
+		}
+		entry.Drift = newCountDrift(startCount, end)
+		if entry.Drift.Percent > r.maxDrift {
+			msg := fmt.Sprintf("%s changed by %.2f%% during backup (%d -> %d docs), above --max-drift %g%%",
+				collName, entry.Drift.Percent, startCount, end, r.maxDrift)
+			if r.abortIfChanging {
+				return entry, errors.New(msg)
+			}
+			fmt.Printf("Warning: %s\n", msg)
+		}
+	}
+	if regexDropped > 0 {
+		fmt.Printf("Stripped %d fields matching %s from %s\n", regexDropped, r.dropRe, collName)
+	}
+	if redacted > 0 {
+		fmt.Printf("Redacted %d fields from %s\n", redacted, collName)
+	}
+	if largeDropped > 0 {
+		fmt.Printf("Dropped %d fields larger than %d bytes from %s\n", largeDropped, r.maxFieldBytes, collName)
+	}
+	fmt.Printf("Done %s (%d docs)\n", collName, count)
+	return entry, nil
+}
+
+// jsonExt is the extension of the JSON Lines files of a directory backup.
+func (r *backupRun) jsonExt() string {
+	if r.gzip {
+		return ".jsonl.gz"
+	}
+	return ".jsonl"
+}
+
+// collFileName is the per-collection file name in directory mode,
+// "<db>.<collection><ext>" with the collection name encoded per
+// --collection-name-encoding.
+func (r *backupRun) collFileName(collName, ext string) string {
+	if r.nameEncoding == "percent" {
+		collName = percentEncodeName(collName)
+	}
+	return r.dbName + "." + collName + ext
+}
+
+// percentEncodeName escapes the characters of a collection name that are
+// ambiguous or invalid in file names: the "." separating db and collection,
+// path separators and the characters Windows reserves. "%" itself is escaped
+// so the encoding can be reversed; other names are left unchanged.
+func percentEncodeName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < 0x20 || strings.IndexByte(`.%/\:*?"<>|`, c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// tolerable reports whether a collection's failure may be skipped under
+// --tolerate-errors. Cancellation and the disk space guard always abort.
+func (r *backupRun) tolerable(ctx context.Context, collName string, err error) bool {
+	if !r.tolerate[collName] || ctx.Err() != nil {
+		return false
+	}
+	return !errors.Is(err, errLowDiskSpace)
+}
+
+// rebuildClient replaces the run's client after a network error and points
+// everything that holds it at the new one. Callers refresh their collection.
+func (r *backupRun) rebuildClient(ctx context.Context, cause error) error {
+	client, err := r.reconnect.rebuild(ctx, cause)
+	if err != nil {
+		return err
+	}
+	r.db = client.Database(r.dbName)
+	r.lag.setClient(client)
+	return nil
+}
+
+// hintNote names the --hint in error messages, since a bad hint is the
+// usual cause of a server error when one is set.
+func (r *backupRun) hintNote() string {
+	if r.hint == nil {
+		return ""
+	}
+	if name, ok := r.hint.(string); ok {
+		return fmt.Sprintf(" (with --hint %q)", name)
+	}
+	b, _ := bson.MarshalExtJSON(r.hint, false, false)
+	return fmt.Sprintf(" (with --hint %s)", b)
+}
+
+// closeCursor kills a server cursor with its own deadline, so it still
+// happens after the run context was cancelled (Ctrl-C, timeout). This matters
+// most for --no-cursor-timeout cursors, which the server never reaps.
+func closeCursor(cur *mongo.Cursor) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_ = cur.Close(ctx)
+}
+
+// limitReached reports whether --limit-total has been hit.
+func (r *backupRun) limitReached() bool {
+	return r.limitTotal > 0 && r.totalDocs.Load() >= r.limitTotal
+}
+
+// docTimeoutRetries bounds how many times in a row a stalled cursor is
+// reopened before the collection fails.
+const docTimeoutRetries = 3
+
+// nextDoc advances the cursor, bounding the wait with --doc-timeout.
+func (r *backupRun) nextDoc(ctx context.Context, cur *mongo.Cursor) bool {
+	if r.docTimeout <= 0 {
+		return cur.Next(ctx)
+	}
+	nctx, cancel := context.WithTimeout(ctx, r.docTimeout)
+	defer cancel()
+	return cur.Next(nctx)
+}
+
+// stalled reports whether the cursor stopped because the --doc-timeout
+// watchdog fired, as opposed to exhaustion or the run being cancelled.
+func (r *backupRun) stalled(ctx context.Context, cur *mongo.Cursor) bool {
+	return r.docTimeout > 0 && ctx.Err() == nil && errors.Is(cur.Err(), context.DeadlineExceeded)
+}
+
+// afterIDFilter restricts filter to documents with an _id greater than last.
+func afterIDFilter(filter bson.M, last interface{}) bson.M {
+	return andFilter(filter, bson.M{"_id": bson.M{"$gt": last}})
+}
+
+// marshalDoc encodes a document as relaxed Extended JSON. JSON Lines must stay
+// one document per line, so --pretty only applies to JSON array output.
+func (r *backupRun) marshalDoc(doc bson.M) ([]byte, error) {
+	var v interface{} = doc
+	if r.fieldOrder {
+		v = sortedFields(doc)
+	}
+	if r.pretty && r.jsonArray {
+		return bson.MarshalExtJSONIndent(v, r.canonical, false, "  ", "  ")
+	}
+	return bson.MarshalExtJSON(v, r.canonical, false)
+}
+
+// writeDoc writes one encoded document, as a JSON Lines record or as the
+// next element of the merged JSON array.
+func (r *backupRun) writeDoc(w io.Writer, extJSON []byte) error {
+	sep := "\n"
+	if r.jsonArray {
+		sep = "\n  "
+		if r.arrayDocs > 0 {
+			sep = ",\n  "
+		}
+		r.arrayDocs++
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		_, err := w.Write(extJSON)
+		return err
+	}
+	if _, err := w.Write(extJSON); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, sep)
+	return err
+}
@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestCollFileNameRoundTrip(t *testing.T) {
+	r := &backupRun{dbName: "shop", nameEncoding: "percent"}
+	names := []string{"orders", "a.b.c", "x/y", `x\y`, "50%", "c:d", "%2E", "what?*"}
+	for _, ext := range []string{".jsonl", ".jsonl.gz"} {
+		for _, name := range names {
+			file := r.collFileName(name, ext)
+			db, coll, ok := splitCollFileName(file)
+			if !ok || db != "shop" || coll != name {
+				t.Errorf("splitCollFileName(%q) = %q, %q, %v; want %q, %q, true", file, db, coll, ok, "shop", name)
+			}
+		}
+	}
+}
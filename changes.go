@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// changeEvent is the subset of a change stream event that changesCmd needs.
+type changeEvent struct {
+	OperationType string `bson:"operationType"`
+	NS            struct {
+		Coll string `bson:"coll"`
+	} `bson:"ns"`
+	FullDocument bson.M      `bson:"fullDocument"`
+	ClusterTime  interface{} `bson:"clusterTime"`
+}
+
+// changesCmd appends documents inserted or updated since the last run to a
+// JSON Lines file, using a change stream resumed from a token file.
+func changesCmd(args []string) {
+	fs := flag.NewFlagSet("changes", flag.ExitOnError)
+	output := fs.String("output", "", "JSON Lines file the changed documents are appended to")
+	tokenFile := fs.String("resume-token-file", "", "File holding the change stream resume token between runs")
+	dbOverride := fs.String("db", "", "Database name override (optional)")
+	collName := fs.String("collection", "", "Only watch this collection (default: the whole database)")
+	uriEnv := fs.String("uri-env", "", "Read the MongoDB URI from this environment variable")
+	profile := fs.String("profile", "", "Saved connection profile to use (default: the default profile)")
+	follow := fs.Bool("follow", false, "Keep running and appending until interrupted, instead of stopping once caught up")
+	tokenEvery := fs.Duration("token-interval", 10*time.Second, "How often --follow persists the resume token")
+	batchSize := fs.Int("batch", 500, "Change stream batch size")
+	timeout := fs.Duration("timeout", 0, "Operation timeout (0 = no timeout)")
+	_ = fs.Parse(args)
+
+	if *output == "" || *tokenFile == "" {
+		fatal(errors.New("changes requires --output and --resume-token-file"))
+	}
+	if err := expandPathFlags(output, tokenFile); err != nil {
+		fatal(err)
+	}
+
+	cfg, err := resolveConfig(*profile, *uriEnv, *dbOverride)
+	if err != nil {
+		fatal(err)
+	}
+	connURI, err := cfg.connectURI()
+	if err != nil {
+		fatal(err)
+	}
+
+	token, err := readResumeToken(*tokenFile)
+	if err != nil {
+		fatal(err)
+	}
+
+	sigCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if *timeout > 0 {
+		ctx, cancel = context.WithTimeout(sigCtx, *timeout)
+	} else {
+		ctx, cancel = context.WithCancel(sigCtx)
+	}
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, clientOptions(connURI))
+	if err != nil {
+		fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "operationType", Value: bson.D{
+		{Key: "$in", Value: bson.A{"insert", "update", "replace"}},
+	}}}}}}
+	csOpts := options.ChangeStream().
+		SetFullDocument(options.UpdateLookup).
+		SetBatchSize(int32(*batchSize))
+	if token != nil {
+		csOpts.SetStartAfter(token)
+	}
+
+	db := client.Database(cfg.DB)
+	var cs *mongo.ChangeStream
+	if *collName != "" {
+		cs, err = db.Collection(*collName).Watch(ctx, pipeline, csOpts)
+	} else {
+		cs, err = db.Watch(ctx, pipeline, csOpts)
+	}
+	if err != nil {
+		fatal(fmt.Errorf("open change stream: %w (change streams require a replica set or sharded cluster)", err))
+	}
+	defer func() { _ = cs.Close(context.Background()) }()
+
+	f, err := os.OpenFile(*output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	w := bufio.NewWriterSize(f, 1<<20)
+
+	if token == nil {
+		fmt.Println("No resume token yet: recording changes from now on")
+	}
+
+	// The token is only persisted after the documents before it are on
+	// disk, so a crash re-reads events rather than losing them.
+	checkpoint := func() {
+		if err := w.Flush(); err != nil {
+			fatal(err)
+		}
+		if err := f.Sync(); err != nil {
+			fatal(err)
+		}
+		if err := writeResumeToken(*tokenFile, cs.ResumeToken()); err != nil {
+			fatal(fmt.Errorf("write resume token: %w", err))
+		}
+	}
+
+	var n int64
+	lastSave := time.Now()
+	for {
+		if !cs.TryNext(ctx) {
+			if ctx.Err() != nil {
+				break
+			}
+			if err := cs.Err(); err != nil {
+				checkpoint()
+				fatal(fmt.Errorf("change stream: %w", err))
+			}
+			if !*follow {
+				break
+			}
+			if time.Since(lastSave) >= *tokenEvery {
+				checkpoint()
+				lastSave = time.Now()
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		var ev changeEvent
+		if err := cs.Decode(&ev); err != nil {
+			fatal(fmt.Errorf("decode change event: %w", err))
+		}
+		if ev.FullDocument == nil {
+			// The document was deleted before updateLookup could fetch it.
+			continue
+		}
+		doc := ev.FullDocument
+		doc["_meta"] = bson.M{"db": cfg.DB, "collection": ev.NS.Coll, "op": ev.OperationType, "clusterTime": ev.ClusterTime}
+		line, err := bson.MarshalExtJSON(doc, false, false)
+		if err != nil {
+			fatal(fmt.Errorf("marshal change: %w", err))
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			fatal(err)
+		}
+		n++
+	}
+	checkpoint()
+	fmt.Printf("Appended %d changed documents to %s\n", n, *output)
+}
+
+// readResumeToken loads the token saved by a previous run; a missing file
+// means this is the first run.
+func readResumeToken(path string) (bson.Raw, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var token bson.Raw
+	if err := bson.UnmarshalExtJSON(b, false, &token); err != nil {
+		return nil, fmt.Errorf("parse resume token %s: %w", path, err)
+	}
+	return token, nil
+}
+
+func writeResumeToken(path string, token bson.Raw) error {
+	if token == nil {
+		return nil
+	}
+	ext, err := bson.MarshalExtJSON(token, false, false)
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(path, json.RawMessage(ext))
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// redactedPassword replaces the password in exported configs. It is a
+// ${KEY} token, so an imported config works once MONGOBAK_PASSWORD is set in
+// the environment or in the profile's secrets file.
+const redactedPassword = "${MONGOBAK_PASSWORD}"
+
+// maskedPassword replaces the password in `config show` output.
+const maskedPassword = "****"
+
+func configCmd(args []string) {
+	if len(args) == 0 {
+		fatal(errors.New("config requires a subcommand: show or migrate"))
+	}
+	switch args[0] {
+	case "show":
+		configShowCmd(args[1:])
+	case "migrate":
+		configMigrateCmd(args[1:])
+	default:
+		fatal(fmt.Errorf("unknown config subcommand: %s", args[0]))
+	}
+}
+
+// configShowCmd prints a profile of the saved config with the URI password
+// masked. --reveal prints it in full, but only to a terminal, so it cannot
+// end up in a pipe, a log file or a pasted ticket by accident.
+func configShowCmd(args []string) {
+	fs := flag.NewFlagSet("config show", flag.ExitOnError)
+	reveal := fs.Bool("reveal", false, "Print the URI including its password (interactive terminals only)")
+	profile := fs.String("profile", "", "Profile to show (default: the default profile)")
+	_ = fs.Parse(args)
+
+	f, path, err := readConfigFile()
+	if err != nil {
+		fatal(err)
+	}
+	cfg, name, err := f.profile(*profile)
+	if err != nil {
+		fatal(err)
+	}
+	if *reveal {
+		if !term.IsTerminal(int(os.Stdout.Fd())) {
+			fatal(errors.New("--reveal requires stdout to be a terminal"))
+		}
+		fmt.Fprintln(os.Stderr, "Warning: printing the URI with its password in clear text.")
+	} else {
+		cfg.URI = replaceURIPassword(cfg.URI, maskedPassword)
+	}
+
+	names := f.profileNames()
+	for i, n := range names {
+		if n == f.Default {
+			names[i] += " (default)"
+		}
+	}
+	fmt.Printf("Config file:  %s\n", path)
+	fmt.Printf("Profiles:     %s\n", strings.Join(names, ", "))
+	fmt.Printf("Profile:      %s\n", name)
+	fmt.Printf("URI:          %s\n", cfg.URI)
+	fmt.Printf("Database:     %s\n", cfg.DB)
+	if cfg.SecretsFile != "" {
+		fmt.Printf("Secrets file: %s\n", cfg.SecretsFile)
+	}
+	if cfg.PromptPassword {
+		fmt.Println("Password:     asked at connect time (or $MONGOBAK_PASSWORD)")
+	}
+}
+
+// configVersion is the schema version written by this build. Bump it with
+// every structural change and add the upgrade step to migrateConfig.
+const configVersion = 2
+
+// decodeConfig parses a config file (or export) of any known version and
+// upgrades it in memory. It also returns the version found in the file.
+func decodeConfig(b []byte) (ConfigFile, int, error) {
+	var head struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(b, &head); err != nil {
+		return ConfigFile{}, 0, err
+	}
+	if head.Version > configVersion {
+		return ConfigFile{}, head.Version, fmt.Errorf("config version %d is newer than this mongobak supports (%d); upgrade mongobak", head.Version, configVersion)
+	}
+	f, err := migrateConfig(b, head.Version)
+	return f, head.Version, err
+}
+
+// migrateConfig upgrades raw config JSON of version from to configVersion.
+// Version 0 (unversioned) files hold the same uri/db/secretsFile fields as
+// version 1; both are single-profile configs that become the profile
+// "default" in version 2. Each later version adds a "from < N" step here,
+// applied in order.
+func migrateConfig(b []byte, from int) (ConfigFile, error) {
+	if from < 2 {
+		var single Config
+		if err := json.Unmarshal(b, &single); err != nil {
+			return ConfigFile{}, err
+		}
+		f := ConfigFile{Version: configVersion, Profiles: map[string]Config{}}
+		if single != (Config{}) {
+			f.Default = "default"
+			f.Profiles["default"] = single
+		}
+		return f, nil
+	}
+	var f ConfigFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return ConfigFile{}, err
+	}
+	if f.Profiles == nil {
+		f.Profiles = map[string]Config{}
+	}
+	f.Version = configVersion
+	return f, nil
+}
+
+// configMigrateCmd rewrites the saved config in the current schema. The
+// file is replaced atomically, so an interrupted migration keeps the old one.
+func configMigrateCmd(args []string) {
+	fs := flag.NewFlagSet("config migrate", flag.ExitOnError)
+	_ = fs.Parse(args)
+
+	path, err := configPath()
+	if err != nil {
+		fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		fatal(fmt.Errorf("read config %s: %w", path, err))
+	}
+	cfg, from, err := decodeConfig(b)
+	if err != nil {
+		fatal(fmt.Errorf("config %s: %w", path, err))
+	}
+	if from == configVersion {
+		fmt.Printf("Config %s is already at version %d.\n", path, configVersion)
+		return
+	}
+	if err := saveConfig(cfg); err != nil {
+		fatal(err)
+	}
+	fmt.Printf("OK: config %s migrated from version %d to %d.\n", path, from, configVersion)
+}
+
+// exportConfigCmd writes the saved config, or only the --profile one (as the
+// export's default), in the config file format.
+func exportConfigCmd(args []string) {
+	fs := flag.NewFlagSet("export-config", flag.ExitOnError)
+	out := fs.String("out", "", "File to write the exported config to (default: stdout)")
+	redact := fs.Bool("redact", false, "Replace the URI password with "+redactedPassword)
+	profile := fs.String("profile", "", "Export only this profile (default: all profiles)")
+	_ = fs.Parse(args)
+
+	if err := expandPathFlags(out); err != nil {
+		fatal(err)
+	}
+	cfg, _, err := readConfigFile()
+	if err != nil {
+		fatal(err)
+	}
+	if *profile != "" {
+		p, name, err := cfg.profile(*profile)
+		if err != nil {
+			fatal(err)
+		}
+		cfg.Default, cfg.Profiles = name, map[string]Config{name: p}
+	}
+	if *redact {
+		for name, p := range cfg.Profiles {
+			p.URI = replaceURIPassword(p.URI, redactedPassword)
+			cfg.Profiles[name] = p
+		}
+	}
+
+	if *out == "" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(cfg); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if err := writeJSONFile(*out, cfg); err != nil {
+		fatal(err)
+	}
+	if err := os.Chmod(*out, 0o600); err != nil {
+		fatal(err)
+	}
+	fmt.Printf("OK: config exported to %s\n", *out)
+	if !*redact {
+		fmt.Fprintln(os.Stderr, "Note: the export contains credentials; use --redact to strip the password.")
+	}
+}
+
+// importConfigCmd loads an exported config (any version). It replaces the
+// saved config, or with --merge adds its profiles to the saved ones.
+func importConfigCmd(args []string) {
+	fs := flag.NewFlagSet("import-config", flag.ExitOnError)
+	in := fs.String("in", "", "Exported config file to import")
+	merge := fs.Bool("merge", false, "Merge the imported profiles into the existing config instead of replacing it")
+	_ = fs.Parse(args)
+
+	if *in == "" {
+		fatal(errors.New("import-config requires --in"))
+	}
+	if err := expandPathFlags(in); err != nil {
+		fatal(err)
+	}
+	b, err := os.ReadFile(*in)
+	if err != nil {
+		fatal(err)
+	}
+	imported, _, err := decodeConfig(b)
+	if err != nil {
+		fatal(fmt.Errorf("parse %s: %w", *in, err))
+	}
+
+	if len(imported.Profiles) == 0 {
+		fatal(fmt.Errorf("%s: config has no profiles", *in))
+	}
+	for _, name := range imported.profileNames() {
+		p := imported.Profiles[name]
+		if p.URI == "" || (p.DB == "" && uriDatabase(p.URI) == "") {
+			fatal(fmt.Errorf("%s: profile %q invalid (missing uri/db)", *in, name))
+		}
+		if _, err := validateURI(p.URI); err != nil && !secretRef.MatchString(p.URI) {
+			fatal(fmt.Errorf("profile %q: %w", name, err))
+		}
+		if err := expandPathFlags(&p.SecretsFile); err != nil {
+			fatal(err)
+		}
+		if p.SecretsFile != "" {
+			if _, err := os.Stat(p.SecretsFile); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: profile %q: secrets file %s not found on this machine\n", name, p.SecretsFile)
+			}
+		}
+		imported.Profiles[name] = p
+	}
+
+	cfg := imported
+	if *merge {
+		if local, _, err := readConfigFile(); err == nil {
+			cfg = mergeConfigFiles(local, imported)
+		}
+	}
+	if _, ok := cfg.Profiles[cfg.Default]; !ok {
+		// An export without a default: use its first profile.
+		cfg.Default = cfg.profileNames()[0]
+	}
+
+	if err := saveConfig(cfg); err != nil {
+		fatal(err)
+	}
+	fmt.Printf("OK: config imported (profiles: %s).\n", strings.Join(imported.profileNames(), ", "))
+}
+
+// mergeConfigFiles adds the imported profiles to local. A profile saved in
+// both is merged field by field; the local default profile is kept.
+func mergeConfigFiles(local, imported ConfigFile) ConfigFile {
+	if local.Profiles == nil {
+		local.Profiles = map[string]Config{}
+	}
+	for _, name := range imported.profileNames() {
+		if p, ok := local.Profiles[name]; ok {
+			local.Profiles[name] = mergeConfig(name, p, imported.Profiles[name])
+		} else {
+			local.Profiles[name] = imported.Profiles[name]
+		}
+	}
+	if local.Default == "" {
+		local.Default = imported.Default
+	}
+	return local
+}
+
+// mergeConfig overlays the non-empty fields of imported on local. Imported
+// values win; every overridden value is reported.
+func mergeConfig(profile string, local, imported Config) Config {
+	out := local
+	for _, f := range []struct {
+		name     string
+		dst      *string
+		imported string
+	}{
+		{"uri", &out.URI, imported.URI},
+		{"db", &out.DB, imported.DB},
+		{"secretsFile", &out.SecretsFile, imported.SecretsFile},
+	} {
+		if f.imported == "" || f.imported == *f.dst {
+			continue
+		}
+		if *f.dst != "" {
+			fmt.Fprintf(os.Stderr, "Warning: profile %q: %s differs from the local config; using the imported value\n", profile, f.name)
+		}
+		*f.dst = f.imported
+	}
+	if imported.URI != "" {
+		// Whether the password is asked for belongs with the URI.
+		out.PromptPassword = imported.PromptPassword
+	}
+	return out
+}
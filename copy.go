@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// copyCmd streams collections from one database to another, possibly on a
+// different cluster, without writing anything to disk.
+func copyCmd(args []string) {
+	fs := flag.NewFlagSet("copy", flag.ExitOnError)
+	sourceURI := fs.String("source-uri", "", "Source MongoDB URI (default: saved config)")
+	sourceDB := fs.String("source-db", "", "Source database (default: saved config)")
+	profile := fs.String("profile", "", "Saved connection profile of the source (default: the default profile)")
+	targetURI := fs.String("target-uri", "", "Target MongoDB URI (default: the source URI)")
+	targetDB := fs.String("target-db", "", "Target database (default: the source database)")
+	exclude := fs.String("exclude", "", "Comma-separated collection names to skip")
+	batchSize := fs.Int("batch", 1000, "Documents per insert batch")
+	dropTarget := fs.Bool("drop-target", false, "Drop each target collection before copying into it")
+	retryWrites := fs.Bool("retry-writes", true, "Use retryable writes on the target (disable for servers that do not support them)")
+	timeout := fs.Duration("timeout", 0, "Operation timeout (0 = no timeout)")
+	_ = fs.Parse(args)
+
+	if *batchSize <= 0 {
+		fatal(fmt.Errorf("invalid --batch %d", *batchSize))
+	}
+
+	src, err := copySource(*profile, *sourceURI, *sourceDB)
+	if err != nil {
+		fatal(err)
+	}
+	dst := src
+	if *targetURI != "" {
+		dst.URI = *targetURI
+	}
+	if *targetDB != "" {
+		dst.DB = *targetDB
+	}
+	if dst.URI == src.URI && dst.DB == src.DB {
+		fatal(errors.New("copy: source and target are the same database (set --target-uri or --target-db)"))
+	}
+
+	srcURI, err := src.connectURI()
+	if err != nil {
+		fatal(fmt.Errorf("source: %w", err))
+	}
+	dstURI, err := dst.connectURI()
+	if err != nil {
+		fatal(fmt.Errorf("target: %w", err))
+	}
+
+	sigCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if *timeout > 0 {
+		ctx, cancel = context.WithTimeout(sigCtx, *timeout)
+	} else {
+		ctx, cancel = context.WithCancel(sigCtx)
+	}
+	defer cancel()
+
+	srcClient, err := mongo.Connect(ctx, clientOptions(srcURI))
+	if err != nil {
+		fatal(err)
+	}
+	defer func() { _ = srcClient.Disconnect(context.Background()) }()
+	dstOpts := clientOptions(dstURI)
+	if flagWasSet(fs, "retry-writes") || dstOpts.RetryWrites == nil {
+		dstOpts.SetRetryWrites(*retryWrites)
+	}
+	dstClient, err := mongo.Connect(ctx, dstOpts)
+	if err != nil {
+		fatal(err)
+	}
+	defer func() { _ = dstClient.Disconnect(context.Background()) }()
+
+	from := srcClient.Database(src.DB)
+	to := dstClient.Database(dst.DB)
+	specs, err := from.ListCollectionSpecifications(ctx, bson.M{})
+	if err != nil {
+		fatal(err)
+	}
+	existing, err := to.ListCollectionNames(ctx, bson.M{})
+	if err != nil {
+		fatal(err)
+	}
+	exists := map[string]bool{}
+	for _, n := range existing {
+		exists[n] = true
+	}
+
+	exSet := map[string]bool{}
+	for _, n := range splitCSV(*exclude) {
+		exSet[n] = true
+	}
+
+	fmt.Printf("Copying %s -> %s\n", src.DB, dst.DB)
+	for _, spec := range specs {
+		name := spec.Name
+		if exSet[name] || strings.HasPrefix(name, "system.") {
+			fmt.Printf("Skipping collection: %s\n", name)
+			continue
+		}
+		if spec.Type == "view" {
+			fmt.Printf("Skipping view: %s\n", name)
+			continue
+		}
+		if *dropTarget && exists[name] {
+			if err := to.Collection(name).Drop(ctx); err != nil {
+				fatal(fmt.Errorf("drop %s.%s: %w", dst.DB, name, err))
+			}
+			exists[name] = false
+		}
+		if !exists[name] {
+			if err := createLike(ctx, to, spec); err != nil {
+				fatal(fmt.Errorf("create %s.%s: %w", dst.DB, name, err))
+			}
+		}
+		n, err := copyCollection(ctx, from.Collection(name), to.Collection(name), *batchSize)
+		if mongo.IsDuplicateKeyError(err) {
+			fatal(fmt.Errorf("copy %s: %d docs copied, then a duplicate key: the target already holds data (use --drop-target to replace it)", name, n))
+		}
+		if err != nil {
+			fatal(fmt.Errorf("copy %s: %w (%d docs copied)", name, err, n))
+		}
+		fmt.Printf("Copied %s (%d docs)\n", name, n)
+	}
+	fmt.Println("Copy complete.")
+}
+
+// copySource returns the source connection of copy: the saved profile, with
+// --source-uri and --source-db on top. When both flags are given the source
+// needs no saved config, so a missing config file is not an error, unless
+// --profile names one; any other problem with the config is.
+func copySource(profile, uri, db string) (Config, error) {
+	src, err := loadConfig(profile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) || profile != "" || uri == "" || db == "" {
+			return Config{}, err
+		}
+		src = Config{}
+	}
+	if uri != "" {
+		src.URI = uri
+	}
+	if db != "" {
+		src.DB = db
+	}
+	if src.DB == "" {
+		src.DB = uriDatabase(src.URI)
+	}
+	if src.DB == "" {
+		return Config{}, errNoDatabase
+	}
+	return src, nil
+}
+
+// createLike creates a collection with the source's options (capped size,
+// collation, validator, time-series spec, ...).
+func createLike(ctx context.Context, db *mongo.Database, spec *mongo.CollectionSpecification) error {
+	cmd := bson.D{{Key: "create", Value: spec.Name}}
+	if len(spec.Options) > 0 {
+		elems, err := spec.Options.Elements()
+		if err != nil {
+			return err
+		}
+		for _, e := range elems {
+			cmd = append(cmd, bson.E{Key: e.Key(), Value: e.Value()})
+		}
+	}
+	return db.RunCommand(ctx, cmd).Err()
+}
+
+// copyCollection reads every document of from and inserts it into to in
+// ordered batches. It returns the number of documents inserted.
+func copyCollection(ctx context.Context, from, to *mongo.Collection, batchSize int) (int64, error) {
+	cur, err := from.Find(ctx, bson.M{}, options.Find().SetBatchSize(int32(batchSize)))
+	if err != nil {
+		return 0, err
+	}
+	defer func() { closeCursor(cur) }()
+
+	var copied int64
+	batch := make([]interface{}, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		res, err := to.InsertMany(ctx, batch)
+		if res != nil {
+			copied += int64(len(res.InsertedIDs))
+		}
+		batch = batch[:0]
+		return err
+	}
+	for cur.Next(ctx) {
+		// cur.Current is reused by the next call to Next.
+		batch = append(batch, append(bson.Raw(nil), cur.Current...))
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return copied, err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return copied, err
+	}
+	if err := flush(); err != nil {
+		return copied, err
+	}
+	return copied, nil
+}
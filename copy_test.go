@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopySourceConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir) // os.UserConfigDir on Linux
+	t.Setenv("HOME", dir)            // on macOS
+	t.Setenv("AppData", dir)         // on Windows
+	cfgPath, err := configPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// No config file: the flags alone describe the source.
+	src, err := copySource("", "mongodb://src:27017", "shop")
+	if err != nil || src.URI != "mongodb://src:27017" || src.DB != "shop" {
+		t.Errorf("without a config: copySource = %+v, %v", src, err)
+	}
+	if _, err := copySource("prod", "mongodb://src:27017", "shop"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("--profile without a config: err = %v, want the missing file", err)
+	}
+	if _, err := copySource("", "mongodb://src:27017", ""); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("--source-uri alone without a config: err = %v, want the missing file", err)
+	}
+
+	// A config that cannot be read is reported even with both flags set.
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfgPath, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := copySource("", "mongodb://src:27017", "shop"); err == nil {
+		t.Error("a malformed config was ignored")
+	}
+}
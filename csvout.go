@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// csvSink writes flattened documents as CSV (--format jsonl,csv). With fixed
+// columns rows are written as they arrive. Otherwise the header is the union
+// of all flattened keys, which is only known at the end, so rows are spooled
+// to a temporary file and the CSV is produced when the collection is done.
+type csvSink struct {
+	f     *os.File
+	w     *bufio.Writer
+	cw    *csv.Writer
+	fixed []string
+
+	spool    *os.File
+	spoolW   *bufio.Writer
+	spoolEnc *json.Encoder
+	keys     map[string]bool
+}
+
+func newCSVSink(path string, columns []string, mode os.FileMode) (*csvSink, error) {
+	f, err := createFile(path, mode)
+	if err != nil {
+		return nil, err
+	}
+	s := &csvSink{f: f, w: bufio.NewWriterSize(f, 1<<20), fixed: columns}
+	s.cw = csv.NewWriter(s.w)
+	if len(columns) > 0 {
+		if err := s.cw.Write(columns); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		return s, nil
+	}
+	spool, err := os.CreateTemp("", "mongobak-csv-*")
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	s.spool = spool
+	s.spoolW = bufio.NewWriterSize(spool, 1<<20)
+	s.spoolEnc = json.NewEncoder(s.spoolW)
+	s.keys = map[string]bool{}
+	return s, nil
+}
+
+func (s *csvSink) write(doc bson.M) error {
+	flat := map[string]string{}
+	flattenInto(flat, "", doc)
+	if s.fixed != nil {
+		return s.cw.Write(csvRow(s.fixed, flat))
+	}
+	for k := range flat {
+		s.keys[k] = true
+	}
+	return s.spoolEnc.Encode(flat)
+}
+
+// close finishes the CSV. After an earlier error (failed) the spool is
+// discarded and the partial CSV removed.
+func (s *csvSink) close(failed, fsync bool) (err error) {
+	if s.spool != nil {
+		defer func() {
+			_ = s.spool.Close()
+			_ = os.Remove(s.spool.Name())
+		}()
+		if !failed {
+			err = s.writeSpooled()
+		}
+	}
+	if err == nil && !failed {
+		s.cw.Flush()
+		err = s.cw.Error()
+	}
+	if err == nil && !failed {
+		err = s.w.Flush()
+	}
+	if err == nil && !failed && fsync {
+		err = s.f.Sync()
+	}
+	if cerr := s.f.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if failed || err != nil {
+		_ = os.Remove(s.f.Name())
+	}
+	return err
+}
+
+func (s *csvSink) writeSpooled() error {
+	if err := s.spoolW.Flush(); err != nil {
+		return err
+	}
+	if _, err := s.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	columns := make([]string, 0, len(s.keys))
+	for k := range s.keys {
+		if k != "_id" {
+			columns = append(columns, k)
+		}
+	}
+	sort.Strings(columns)
+	if s.keys["_id"] {
+		columns = append([]string{"_id"}, columns...)
+	}
+	if err := s.cw.Write(columns); err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bufio.NewReaderSize(s.spool, 1<<20))
+	for {
+		var flat map[string]string
+		if err := dec.Decode(&flat); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("csv spool: %w", err)
+		}
+		if err := s.cw.Write(csvRow(columns, flat)); err != nil {
+			return err
+		}
+	}
+}
+
+func csvRow(columns []string, flat map[string]string) []string {
+	row := make([]string, len(columns))
+	for i, c := range columns {
+		row[i] = flat[c]
+	}
+	return row
+}
+
+// flattenInto adds the scalar fields of a document under dotted keys
+// ("address.city"). Arrays are kept whole as their Extended JSON text, since
+// their length varies from document to document.
+func flattenInto(out map[string]string, prefix string, v interface{}) {
+	switch x := v.(type) {
+	case bson.M:
+		for k, e := range x {
+			flattenInto(out, joinKey(prefix, k), e)
+		}
+		return
+	case bson.D:
+		for _, e := range x {
+			flattenInto(out, joinKey(prefix, e.Key), e.Value)
+		}
+		return
+	}
+	out[prefix] = csvValue(v)
+}
+
+func joinKey(prefix, k string) string {
+	if prefix == "" {
+		return k
+	}
+	return prefix + "." + k
+}
+
+func csvValue(v interface{}) string {
+	switch x := v.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return ""
+	case string:
+		return x
+	case bool:
+		return strconv.FormatBool(x)
+	case int32:
+		return strconv.FormatInt(int64(x), 10)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case primitive.ObjectID:
+		return x.Hex()
+	case primitive.DateTime:
+		return x.Time().UTC().Format(time.RFC3339Nano)
+	case primitive.Decimal128:
+		return x.String()
+	}
+	b, err := bson.MarshalExtJSON(bson.M{"v": v}, false, false)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	var wrapped struct {
+		V json.RawMessage `json:"v"`
+	}
+	if json.Unmarshal(b, &wrapped) != nil {
+		return string(b)
+	}
+	return string(wrapped.V)
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// diskUsage returns the bytes available to unprivileged users and the total
+// size of the filesystem holding path.
+func diskUsage(path string) (free, total uint64, err error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	bsize := uint64(st.Bsize)
+	return uint64(st.Bavail) * bsize, uint64(st.Blocks) * bsize, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const diskCheckInterval = 5 * time.Second
+
+var errLowDiskSpace = errors.New("free disk space below --min-free-percent")
+
+// diskGuard aborts a backup when free space on the output filesystem drops
+// below minPercent. A nil guard never fails.
+type diskGuard struct {
+	path       string
+	minPercent float64
+
+	mu   sync.Mutex // --parallel workers share the guard
+	last time.Time
+}
+
+func newDiskGuard(output string, minPercent float64) *diskGuard {
+	if minPercent <= 0 {
+		return nil
+	}
+	return &diskGuard{path: output, minPercent: minPercent}
+}
+
+// check measures free space at most every diskCheckInterval.
+func (g *diskGuard) check(collName string) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if time.Since(g.last) < diskCheckInterval {
+		return nil
+	}
+	g.last = time.Now()
+
+	free, total, err := diskUsage(existingDir(g.path))
+	if err != nil {
+		return fmt.Errorf("disk space check: %w", err)
+	}
+	if total == 0 {
+		return nil
+	}
+	pct := 100 * float64(free) / float64(total)
+	if pct < g.minPercent {
+		return fmt.Errorf("aborted while backing up %s: free space on %s is %.1f%% (%s): %w (%.1f%%)",
+			collName, g.path, pct, formatBytes(int64(free)), errLowDiskSpace, g.minPercent)
+	}
+	return nil
+}
+
+// existingDir walks up from path to the nearest directory that exists.
+func existingDir(path string) string {
+	p := path
+	for {
+		if isExistingDir(p) {
+			return p
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return p
+		}
+		p = parent
+	}
+}
+
+func isExistingDir(path string) bool {
+	st, err := os.Stat(path)
+	return err == nil && st.IsDir()
+}
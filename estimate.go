@@ -0,0 +1,165 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// collEstimate is the projected JSON Lines size of one collection.
+type collEstimate struct {
+	name    string
+	docs    int64 // estimated document count
+	sampled int
+	avgDoc  float64 // bytes per line, newline included
+	jsonl   int64
+	gzip    int64
+}
+
+// estimateCmd projects the size of a backup from a $sample of every
+// collection: the sampled documents are encoded exactly as backup writes
+// them, so the estimate reflects the output format rather than the BSON
+// storage size reported by collStats.
+func estimateCmd(args []string) {
+	fs := flag.NewFlagSet("estimate", flag.ExitOnError)
+	dbOverride := fs.String("db", "", "Database to estimate (default: saved config)")
+	uriEnv := fs.String("uri-env", "", "Read the MongoDB URI from this environment variable")
+	profile := fs.String("profile", "", "Saved connection profile to use (default: the default profile)")
+	exclude := fs.String("exclude", "", "Comma-separated collection names to skip")
+	fraction := fs.Float64("fraction", 0.01, "Share of each collection to sample (0-1]")
+	minSample := fs.Int("min-sample", 100, "Sample at least this many documents per collection")
+	maxSample := fs.Int("max-sample", 10000, "Sample at most this many documents per collection")
+	canonical := fs.Bool("canonical", false, "Estimate canonical instead of relaxed Extended JSON")
+	timeout := fs.Duration("timeout", 5*time.Minute, "Operation timeout")
+	_ = fs.Parse(args)
+
+	if *fraction <= 0 || *fraction > 1 {
+		fatal(fmt.Errorf("invalid --fraction %v (want 0-1]", *fraction))
+	}
+	if *minSample < 1 || *maxSample < *minSample {
+		fatal(fmt.Errorf("invalid sample bounds --min-sample %d / --max-sample %d", *minSample, *maxSample))
+	}
+	cfg, err := resolveConfig(*profile, *uriEnv, *dbOverride)
+	if err != nil {
+		fatal(err)
+	}
+	connURI, err := cfg.connectURI()
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	client, err := mongo.Connect(ctx, clientOptions(connURI))
+	if err != nil {
+		fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+
+	db := client.Database(cfg.DB)
+	// Views are skipped: sampling one runs its whole pipeline.
+	colls, err := db.ListCollectionNames(ctx, bson.D{{Key: "type", Value: bson.D{{Key: "$ne", Value: "view"}}}})
+	if err != nil {
+		fatal(err)
+	}
+	exSet := map[string]bool{}
+	for _, n := range splitCSV(*exclude) {
+		exSet[n] = true
+	}
+	colls, err = selectCollections(ctx, db, colls, collSelector{exclude: exSet})
+	if err != nil {
+		fatal(err)
+	}
+
+	var ests []collEstimate
+	for _, name := range colls {
+		e, err := estimateCollection(ctx, db.Collection(name), *fraction, *minSample, *maxSample, *canonical)
+		if err != nil {
+			fatal(fmt.Errorf("estimate %s: %w", name, err))
+		}
+		ests = append(ests, e)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COLLECTION\tDOCS\tSAMPLED\tAVG DOC\tJSONL\tGZIP")
+	var total collEstimate
+	for _, e := range ests {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\n", e.name, e.docs, e.sampled,
+			formatBytes(int64(e.avgDoc)), formatBytes(e.jsonl), formatBytes(e.gzip))
+		total.docs += e.docs
+		total.sampled += e.sampled
+		total.jsonl += e.jsonl
+		total.gzip += e.gzip
+	}
+	fmt.Fprintf(tw, "TOTAL\t%d\t%d\t\t%s\t%s\n", total.docs, total.sampled, formatBytes(total.jsonl), formatBytes(total.gzip))
+	_ = tw.Flush()
+	fmt.Println("Estimated from a random sample; document counts come from collection metadata.")
+}
+
+// estimateCollection samples a share of coll, bounded by minSample and
+// maxSample, and scales the encoded sizes up to the estimated document count.
+func estimateCollection(ctx context.Context, coll *mongo.Collection, fraction float64, minSample, maxSample int, canonical bool) (collEstimate, error) {
+	e := collEstimate{name: coll.Name()}
+	docs, err := coll.EstimatedDocumentCount(ctx)
+	if err != nil {
+		return e, err
+	}
+	e.docs = docs
+	if docs == 0 {
+		return e, nil
+	}
+	size := int64(float64(docs) * fraction)
+	if size < int64(minSample) {
+		size = int64(minSample)
+	}
+	if size > int64(maxSample) {
+		size = int64(maxSample)
+	}
+
+	cur, err := coll.Aggregate(ctx, bson.A{bson.D{{Key: "$sample", Value: bson.D{{Key: "size", Value: size}}}}})
+	if err != nil {
+		return e, err
+	}
+	defer closeCursor(cur)
+
+	raw := &countingWriter{w: io.Discard}
+	zipped := &countingWriter{w: io.Discard}
+	zw := gzip.NewWriter(zipped)
+	w := io.MultiWriter(raw, zw)
+	for cur.Next(ctx) {
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			return e, err
+		}
+		line, err := bson.MarshalExtJSON(doc, canonical, false)
+		if err != nil {
+			return e, err
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return e, err
+		}
+		e.sampled++
+	}
+	if err := cur.Err(); err != nil {
+		return e, err
+	}
+	if err := zw.Close(); err != nil {
+		return e, err
+	}
+	if e.sampled == 0 {
+		return e, nil
+	}
+	e.avgDoc = float64(raw.n) / float64(e.sampled)
+	scale := float64(docs) / float64(e.sampled)
+	e.jsonl = int64(float64(raw.n) * scale)
+	e.gzip = int64(float64(zipped.n) * scale)
+	return e, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// sortedFields returns doc as a bson.D with keys in byte order at every
+// depth (--canonical-field-order), so identical data always encodes to
+// identical bytes whatever order the map iterates in. The top-level _id
+// stays first, where MongoDB keeps it.
+func sortedFields(doc bson.M) bson.D {
+	out := sortedValue(doc).(bson.D)
+	for i, e := range out {
+		if e.Key == "_id" && i > 0 {
+			copy(out[1:i+1], out[:i])
+			out[0] = e
+			break
+		}
+	}
+	return out
+}
+
+func sortedValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case bson.M:
+		out := make(bson.D, 0, len(x))
+		for k, e := range x {
+			out = append(out, bson.E{Key: k, Value: sortedValue(e)})
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+		return out
+	case bson.D:
+		out := make(bson.D, len(x))
+		for i, e := range x {
+			out[i] = bson.E{Key: e.Key, Value: sortedValue(e.Value)}
+		}
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+		return out
+	case bson.A:
+		out := make(bson.A, len(x))
+		for i, e := range x {
+			out[i] = sortedValue(e)
+		}
+		return out
+	}
+	return v
+}
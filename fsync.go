@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"runtime"
+)
+
+// syncPath flushes a file (or directory) that is already written and closed
+// to stable storage.
+func syncPath(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir makes file creations and renames in dir durable. Windows cannot
+// sync a directory handle, and NTFS journals metadata anyway.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	return syncPath(dir)
+}
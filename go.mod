@@ -2,7 +2,11 @@ module mongobak
 
 go 1.22
 
-require go.mongodb.org/mongo-driver v1.13.1
+require (
+	go.mongodb.org/mongo-driver v1.13.1
+	golang.org/x/sys v0.20.0
+	golang.org/x/term v0.20.0
+)
 
 require (
 	github.com/golang/snappy v0.0.1 // indirect
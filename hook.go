@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// hookVars are the placeholders of --post-hook, also exported to the hook
+// as MONGOBAK_<NAME> environment variables.
+type hookVars struct {
+	Dir      string // directory holding the backup
+	Output   string // --output as given (directory or merged file)
+	Manifest string // manifest path
+	Summary  string // --summary-json path; "" when not written
+}
+
+// runPostHook runs command through the platform shell once the backup is
+// complete. Placeholders are replaced by shell-quoted values, and the hook's
+// output is logged line by line with a "[hook]" prefix.
+func runPostHook(ctx context.Context, command string, v hookVars) error {
+	vals := map[string]string{"dir": v.Dir, "output": v.Output, "manifest": v.Manifest, "summary": v.Summary}
+	expanded := command
+	for name, val := range vals {
+		expanded = strings.ReplaceAll(expanded, "{"+name+"}", shellQuote(val))
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", expanded)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", expanded)
+	}
+	cmd.Env = append(os.Environ(),
+		"MONGOBAK_DIR="+v.Dir,
+		"MONGOBAK_OUTPUT="+v.Output,
+		"MONGOBAK_MANIFEST="+v.Manifest,
+		"MONGOBAK_SUMMARY="+v.Summary,
+	)
+	out := &prefixWriter{w: os.Stdout, prefix: "[hook] "}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	fmt.Printf("Running post-backup hook: %s\n", command)
+	err := cmd.Run()
+	out.flush()
+	if err != nil {
+		return fmt.Errorf("post-backup hook: %w", err)
+	}
+	fmt.Println("Post-backup hook finished.")
+	return nil
+}
+
+// shellQuote quotes s as a single argument for the shell runPostHook uses.
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// prefixWriter writes each complete line with a prefix; a trailing partial
+// line is held until more output arrives or flush is called. Stdout and
+// stderr of the hook share one writer, so their lines never interleave.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := fmt.Fprintf(p.w, "%s%s\n", p.prefix, p.buf[:i]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+func (p *prefixWriter) flush() {
+	if len(p.buf) > 0 {
+		fmt.Fprintf(p.w, "%s%s\n", p.prefix, p.buf)
+		p.buf = nil
+	}
+}
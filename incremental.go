@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// previousBackup finds the newest backup of dbName next to output (in the
+// directory that holds it), skipping output's own manifest. It returns an
+// empty path when there is none.
+func previousBackup(output string, isDir bool, dbName string) (string, Manifest, error) {
+	own := filepath.Clean(manifestPath(output, isDir))
+	if _, err := os.Stat(own); err == nil {
+		return "", Manifest{}, fmt.Errorf("--since-last-backup writes a new backup, but %s already holds one (use a fresh --output per run)", output)
+	}
+	root := filepath.Dir(strings.TrimRight(output, `/\`))
+	if _, err := os.Stat(root); errors.Is(err, fs.ErrNotExist) {
+		// First run into a directory not created yet: nothing to build on.
+		return "", Manifest{}, nil
+	}
+	entries, err := scanBackups(root)
+	if err != nil {
+		return "", Manifest{}, err
+	}
+	var best *backupEntry
+	for i, e := range entries {
+		if e.DB != dbName || filepath.Clean(e.Manifest) == own {
+			continue
+		}
+		if best == nil || e.CreatedAt.After(best.CreatedAt) {
+			best = &entries[i]
+		}
+	}
+	if best == nil {
+		return "", Manifest{}, nil
+	}
+	m, err := readManifest(best.Manifest)
+	return best.Manifest, m, err
+}
+
+// sinceIDs returns the recorded max _id of every collection in m, decoded
+// back to BSON values for an {_id: {$gt: ...}} filter.
+func sinceIDs(m Manifest) (map[string]interface{}, error) {
+	ids := map[string]interface{}{}
+	for _, c := range m.Collections {
+		if len(c.MaxID) == 0 {
+			continue
+		}
+		id, err := decodeMaxID(c.MaxID)
+		if err != nil {
+			return nil, fmt.Errorf("maxId of %s: %w", c.Name, err)
+		}
+		ids[c.Name] = id
+	}
+	return ids, nil
+}
+
+// encodeMaxID renders an _id as canonical Extended JSON so its BSON type
+// survives the manifest (an int64 must not come back as an int32).
+func encodeMaxID(id interface{}) (json.RawMessage, error) {
+	b, err := bson.MarshalExtJSON(bson.D{{Key: "_id", Value: id}}, true, false)
+	if err != nil {
+		return nil, err
+	}
+	var wrap map[string]json.RawMessage
+	if err := json.Unmarshal(b, &wrap); err != nil {
+		return nil, err
+	}
+	return wrap["_id"], nil
+}
+
+func decodeMaxID(raw json.RawMessage) (interface{}, error) {
+	var doc bson.M
+	if err := bson.UnmarshalExtJSON([]byte(`{"_id":`+string(raw)+`}`), true, &doc); err != nil {
+		return nil, err
+	}
+	return doc["_id"], nil
+}
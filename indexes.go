@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// writeIndexes writes the index specs of coll, as listed by listIndexes, to
+// <db>.<coll>.indexes.json next to the data and returns the file name. In
+// merged mode the file goes beside the merged file and, like its manifest,
+// is named after it (<stem>.<db>.<coll>.indexes.json), so two merged backups
+// in one directory keep their own. Views have no indexes and are skipped.
+// Indexes named in --exclude-index are left out and their names returned.
+func (r *backupRun) writeIndexes(ctx context.Context, coll *mongo.Collection) (string, []string, error) {
+	if spec := r.specs[coll.Name()]; spec != nil && spec.Type == "view" {
+		return "", nil, nil
+	}
+	cur, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	defer closeCursor(cur)
+	specs := []json.RawMessage{}
+	var excluded []string
+	for cur.Next(ctx) {
+		if name, _ := cur.Current.Lookup("name").StringValueOK(); r.excludeIndexes[name] {
+			fmt.Printf("Excluding index %s of %s\n", name, coll.Name())
+			excluded = append(excluded, name)
+			continue
+		}
+		spec, err := bson.MarshalExtJSON(cur.Current, r.canonical, false)
+		if err != nil {
+			return "", nil, err
+		}
+		specs = append(specs, spec)
+	}
+	if err := cur.Err(); err != nil {
+		return "", nil, err
+	}
+
+	name := r.collFileName(coll.Name(), ".indexes.json")
+	path := filepath.Join(r.output, name)
+	if !r.isDir {
+		path = outputStem(r.output) + "." + name
+		name = filepath.Base(path)
+	}
+	if err := writeJSONFile(path, specs); err != nil {
+		return "", nil, err
+	}
+	if r.fileMode != 0 {
+		if err := os.Chmod(path, r.fileMode); err != nil {
+			return "", nil, err
+		}
+	}
+	if r.fsync {
+		if err := syncPath(path); err != nil {
+			return "", nil, err
+		}
+	}
+	return name, excluded, nil
+}
+
+// indexFile returns the index spec file of a collection restored from
+// dataFile: the one named in the manifest, else the sibling of a
+// <db>.<coll>.jsonl file (or of a partition of it). It returns "" when there
+// is none.
+func (r *restoreRun) indexFile(collName, dataFile string) string {
+	if r.noIndexes {
+		return ""
+	}
+	if name := r.manifestEntry(collName).Indexes; name != "" {
+		return filepath.Join(r.indexDir, name)
+	}
+	if r.manifest != nil || dataFile == "" {
+		return ""
+	}
+	base := strings.TrimSuffix(strings.TrimSuffix(dataFile, ".gz"), ".jsonl")
+	dir, stem := filepath.Split(base)
+	path := filepath.Join(dir, trimBucket(stem)+".indexes.json")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// indexJob is the saved index spec file of one restored collection.
+type indexJob struct {
+	coll *mongo.Collection
+	path string
+}
+
+// createIndexes recreates the saved indexes of coll from path, or with
+// --defer-indexes queues them until every collection is loaded.
+func (r *restoreRun) createIndexes(ctx context.Context, coll *mongo.Collection, path string) error {
+	if r.deferIdx {
+		r.mu.Lock()
+		r.deferred = append(r.deferred, indexJob{coll: coll, path: path})
+		r.mu.Unlock()
+		return nil
+	}
+	if err := restoreIndexes(ctx, coll, path); err != nil {
+		return fmt.Errorf("indexes %s: %w", coll.Name(), err)
+	}
+	return nil
+}
+
+// buildDeferred recreates the indexes queued by --defer-indexes, n
+// collections at a time, and reports how long they took in total.
+func (r *restoreRun) buildDeferred(ctx context.Context, n int) error {
+	fmt.Printf("Building the indexes of %d collections\n", len(r.deferred))
+	start := time.Now()
+	if err := buildIndexesParallel(ctx, r.deferred, n); err != nil {
+		return err
+	}
+	fmt.Printf("Built the indexes of %d collections in %s\n", len(r.deferred), time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// restoreIndexes recreates the indexes listed in path on coll. The specs
+// are passed to createIndexes as written, so every option (partial filters,
+// collation, TTL, ...) survives; the implicit _id index is left out.
+func restoreIndexes(ctx context.Context, coll *mongo.Collection, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	specs := bson.A{}
+	for i, r := range raw {
+		var spec bson.D
+		if err := bson.UnmarshalExtJSON(r, false, &spec); err != nil {
+			return fmt.Errorf("%s: index %d: %w", path, i+1, err)
+		}
+		out := make(bson.D, 0, len(spec))
+		name := ""
+		for _, e := range spec {
+			switch e.Key {
+			case "v", "ns":
+				// Index version and namespace are chosen by the target.
+				continue
+			case "name":
+				name, _ = e.Value.(string)
+			}
+			out = append(out, e)
+		}
+		if name == "_id_" {
+			continue
+		}
+		if name == "" {
+			return fmt.Errorf("%s: index %d has no name", path, i+1)
+		}
+		specs = append(specs, out)
+	}
+	if len(specs) == 0 {
+		return nil
+	}
+	cmd := bson.D{{Key: "createIndexes", Value: coll.Name()}, {Key: "indexes", Value: specs}}
+	if err := coll.Database().RunCommand(ctx, cmd).Err(); err != nil {
+		var ce mongo.CommandError
+		if errors.As(err, &ce) && ce.Name == "IndexOptionsConflict" {
+			return fmt.Errorf("%w (an index with the same keys but other options exists; use --drop or --no-indexes)", err)
+		}
+		return err
+	}
+	fmt.Printf("Restored %d indexes on %s\n", len(specs), coll.Name())
+	return nil
+}
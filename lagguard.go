@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const lagCheckInterval = 10 * time.Second
+
+// lagGuard pauses a backup while a replica set secondary lags the primary by
+// more than maxLag (--max-replication-lag). A nil guard never waits.
+type lagGuard struct {
+	admin  *mongo.Database
+	maxLag time.Duration
+
+	// mu is held while paused, so every --parallel worker waits.
+	mu       sync.Mutex
+	last     time.Time
+	disabled bool
+}
+
+func newLagGuard(client *mongo.Client, maxLag time.Duration) *lagGuard {
+	if maxLag <= 0 {
+		return nil
+	}
+	return &lagGuard{admin: client.Database("admin"), maxLag: maxLag}
+}
+
+// setClient points the guard at a rebuilt client (--on-network-error).
+func (g *lagGuard) setClient(client *mongo.Client) {
+	if g != nil {
+		g.admin = client.Database("admin")
+	}
+}
+
+// wait measures the lag at most every lagCheckInterval and blocks while it
+// is above the threshold. If the lag cannot be read (standalone server,
+// missing privilege) it warns once and stops checking.
+func (g *lagGuard) wait(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.disabled || time.Since(g.last) < lagCheckInterval {
+		return nil
+	}
+	g.last = time.Now()
+
+	paused := false
+	for {
+		lag, member, err := g.replicationLag(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fmt.Fprintf(os.Stderr, "Warning: replication lag not available, --max-replication-lag disabled: %v\n", err)
+			g.disabled = true
+			return nil
+		}
+		if lag <= g.maxLag {
+			if paused {
+				fmt.Printf("Replication lag back to %s; resuming\n", lag.Round(time.Second))
+			}
+			return nil
+		}
+		if !paused {
+			fmt.Printf("Replication lag on %s is %s (above %s); pausing backup\n", member, lag.Round(time.Second), g.maxLag)
+			paused = true
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lagCheckInterval):
+		}
+	}
+}
+
+// replicationLag returns the largest delay of a secondary behind the
+// primary, from replSetGetStatus.
+func (g *lagGuard) replicationLag(ctx context.Context) (time.Duration, string, error) {
+	var status struct {
+		Members []struct {
+			Name       string    `bson:"name"`
+			StateStr   string    `bson:"stateStr"`
+			OptimeDate time.Time `bson:"optimeDate"`
+		} `bson:"members"`
+	}
+	if err := g.admin.RunCommand(ctx, bson.D{{Key: "replSetGetStatus", Value: 1}}).Decode(&status); err != nil {
+		return 0, "", err
+	}
+	var primary time.Time
+	for _, m := range status.Members {
+		if m.StateStr == "PRIMARY" {
+			primary = m.OptimeDate
+		}
+	}
+	if primary.IsZero() {
+		return 0, "", nil
+	}
+	var worst time.Duration
+	var worstName string
+	for _, m := range status.Members {
+		if m.StateStr != "SECONDARY" {
+			continue
+		}
+		if lag := primary.Sub(m.OptimeDate); lag > worst {
+			worst, worstName = lag, m.Name
+		}
+	}
+	return worst, worstName, nil
+}
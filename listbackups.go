@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// backupEntry is one backup found by list-backups.
+type backupEntry struct {
+	Manifest    string            `json:"manifest"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	DB          string            `json:"db"`
+	Collections int               `json:"collections"`
+	Docs        int64             `json:"docs"`
+	Bytes       int64             `json:"bytes"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+func listBackupsCmd(args []string) {
+	fset := flag.NewFlagSet("list-backups", flag.ExitOnError)
+	root := fset.String("path", ".", "Directory to scan for backup manifests")
+	asJSON := fset.Bool("json", false, "Print JSON instead of a table")
+	sortBy := fset.String("sort-by", "time", "Sort order: time or size")
+	_ = fset.Parse(args)
+
+	if *sortBy != "time" && *sortBy != "size" {
+		fatal(fmt.Errorf("invalid --sort-by %q (want time or size)", *sortBy))
+	}
+
+	if err := expandPathFlags(root); err != nil {
+		fatal(err)
+	}
+	entries, err := scanBackups(*root)
+	if err != nil {
+		fatal(err)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if *sortBy == "size" {
+			return entries[i].Bytes > entries[j].Bytes
+		}
+		return entries[i].CreatedAt.After(entries[j].CreatedAt)
+	})
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(entries); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if len(entries) == 0 {
+		fmt.Printf("No backups found under %s\n", *root)
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CREATED\tDB\tCOLLECTIONS\tDOCS\tSIZE\tTAGS\tMANIFEST")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\t%s\n",
+			e.CreatedAt.Local().Format("2006-01-02 15:04:05"), e.DB, e.Collections, e.Docs,
+			formatBytes(e.Bytes), tagFlag(e.Tags).String(), e.Manifest)
+	}
+	_ = tw.Flush()
+}
+
+// scanBackups walks root and loads every manifest it finds.
+func scanBackups(root string) ([]backupEntry, error) {
+	var out []backupEntry
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isManifestFile(d.Name()) {
+			return nil
+		}
+		m, err := readManifest(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", path, err)
+			return nil
+		}
+		out = append(out, manifestEntry(path, m))
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("backup path %s does not exist", root)
+	}
+	return out, err
+}
+
+func manifestEntry(path string, m Manifest) backupEntry {
+	e := backupEntry{
+		Manifest:    path,
+		CreatedAt:   m.CreatedAt,
+		DB:          m.DB,
+		Collections: len(m.Collections),
+		Tags:        m.Tags,
+	}
+	dir := filepath.Dir(path)
+	seen := map[string]bool{}
+	for _, c := range m.Collections {
+		e.Docs += c.Docs
+		files := []string{c.File}
+		for _, p := range c.Partitions {
+			files = append(files, p.File)
+		}
+		for _, f := range files {
+			if f == "" || seen[f] {
+				continue
+			}
+			seen[f] = true
+			if st, err := os.Stat(filepath.Join(dir, f)); err == nil {
+				e.Bytes += st.Size()
+			}
+		}
+	}
+	return e
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), strings.ToUpper("kmgtpe")[exp])
+}
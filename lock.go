@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockInfo is written into the lock file to identify its owner.
+type lockInfo struct {
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// lockPath returns the lock guarding an output: .mongobak.lock inside an
+// output directory, or "<file>.lock" next to a merged file.
+func lockPath(output string, isDir bool) string {
+	if isDir {
+		return filepath.Join(output, ".mongobak.lock")
+	}
+	return output + ".lock"
+}
+
+// acquireLock creates the lock file exclusively. With force, an existing
+// (stale) lock is removed first.
+func acquireLock(path string, force bool) error {
+	if force {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		msg := "backup already in progress"
+		if b, rerr := os.ReadFile(path); rerr == nil {
+			var li lockInfo
+			if json.Unmarshal(b, &li) == nil && li.PID != 0 {
+				msg = fmt.Sprintf("%s (pid %d on %s since %s)", msg, li.PID, li.Host, li.StartedAt.Format(time.RFC3339))
+			}
+		}
+		return fmt.Errorf("%s: lock %s exists; if no backup is running, rerun with --force-unlock", msg, path)
+	}
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	b, _ := json.Marshal(lockInfo{PID: os.Getpid(), Host: host, StartedAt: time.Now().UTC()})
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+func releaseLock(path string) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "Warning: remove lock %s: %v\n", path, err)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home) // os.UserHomeDir on Windows
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sep := string(os.PathSeparator)
+	abs := filepath.Join(home, "abs", "out.jsonl")
+
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"~", home},
+		{"~/", home + sep},
+		{"~/backups", filepath.Join(home, "backups")},
+		{"~/backups/", filepath.Join(home, "backups") + sep},
+		{"~user/backups", filepath.Join(wd, "~user", "backups")},
+		{"backups/nightly", filepath.Join(wd, "backups", "nightly")},
+		{"./out.jsonl", filepath.Join(wd, "out.jsonl")},
+		{abs, abs},
+	}
+	for _, tt := range tests {
+		got, err := expandPath(tt.in)
+		if err != nil {
+			t.Errorf("expandPath(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("expandPath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Manifest describes what a backup run produced. It is written next to the
+// backup output so later commands can inspect a backup without reading it.
+type Manifest struct {
+	Tool        string               `json:"tool"`
+	Version     string               `json:"version"`
+	DB          string               `json:"db"`
+	CreatedAt   time.Time            `json:"createdAt"`
+	Output      string               `json:"output"`
+	Merged      bool                 `json:"merged"`
+	Bytes       int64                `json:"bytes,omitempty"` // size of the merged file
+	Canonical   bool                 `json:"canonical,omitempty"`
+	Compression string               `json:"compression,omitempty"`
+	Server      *ServerInfo          `json:"server,omitempty"`
+	Tags        map[string]string    `json:"tags,omitempty"`
+	Filters     *ManifestFilters     `json:"filters,omitempty"`
+	AuthFile    string               `json:"authFile,omitempty"`
+	Collections []CollectionManifest `json:"collections"`
+	Errors      []CollectionError    `json:"errors,omitempty"`
+
+	// NameEncoding is how collection names were encoded into file names
+	// (see File); "percent" escapes '.', '%', path separators and characters
+	// reserved on Windows as %XX.
+	NameEncoding string `json:"nameEncoding,omitempty"`
+
+	// SinceBackup is the manifest of the backup this one continues from
+	// (--since-last-backup); only documents after its max _id are included.
+	SinceBackup string `json:"sinceBackup,omitempty"`
+
+	// Stopped is set when the run ended early on purpose (--max-runtime).
+	Stopped *RunStop `json:"stopped,omitempty"`
+}
+
+// RunStop lists the collections an early stop left out, and the one a later
+// run should resume from (--resume-from-collection).
+type RunStop struct {
+	Reason     string   `json:"reason"`
+	ResumeFrom string   `json:"resumeFrom,omitempty"`
+	Skipped    []string `json:"skipped"`
+}
+
+// CollectionError records a collection skipped by --tolerate-errors.
+type CollectionError struct {
+	Collection string `json:"collection"`
+	Error      string `json:"error"`
+}
+
+// CollectionManifest is the manifest entry for one backed up collection.
+type CollectionManifest struct {
+	Name  string           `json:"name"`
+	File  string           `json:"file"`
+	Docs  int64            `json:"docs"`
+	Stats *CollectionStats `json:"stats,omitempty"`
+
+	// Bytes is the size of File on disk; SHA256 its checksum (set with
+	// --file-index).
+	Bytes  int64  `json:"bytes,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+
+	// BSONFile and CSVFile are the extra copies written with --format.
+	BSONFile string `json:"bsonFile,omitempty"`
+	CSVFile  string `json:"csvFile,omitempty"`
+
+	// Indexes is the file holding the collection's index specs, next to the
+	// data (<db>.<coll>.indexes.json); restore recreates them from it.
+	Indexes string `json:"indexes,omitempty"`
+
+	// ExcludedIndexes names the indexes left out of Indexes with
+	// --exclude-index; restore does not recreate them.
+	ExcludedIndexes []string `json:"excludedIndexes,omitempty"`
+
+	LargeFieldsDropped  int64                `json:"largeFieldsDropped,omitempty"`
+	RegexFieldsDropped  int64                `json:"regexFieldsDropped,omitempty"`
+	RoundtripMismatches int64                `json:"roundtripMismatches,omitempty"`
+	NumbersStringified  int64                `json:"numbersStringified,omitempty"`
+	FieldsRedacted      int64                `json:"fieldsRedacted,omitempty"`
+	Pipeline            json.RawMessage      `json:"pipeline,omitempty"`
+	Validator           *CollectionValidator `json:"validator,omitempty"`
+	Options             json.RawMessage      `json:"options,omitempty"`
+	CountCheck          *CountCheck          `json:"countCheck,omitempty"`
+
+	// Partitions replace File with --output-split-by-date: one JSON Lines
+	// file per period of the split's time field.
+	Partitions []FilePartition `json:"partitions,omitempty"`
+
+	// PrePostImages: changeStreamPreAndPostImages is enabled. The setting is
+	// kept in Options, but the stored images themselves are not backed up.
+	PrePostImages bool `json:"changeStreamPreAndPostImages,omitempty"`
+
+	// Drift is the document count change while the collection was read
+	// (--max-drift).
+	Drift *CountDrift `json:"drift,omitempty"`
+
+	// MaxID is the highest _id written, as canonical Extended JSON
+	// (--since-last-backup resumes after it).
+	MaxID json.RawMessage `json:"maxId,omitempty"`
+
+	written int64 // bytes of Extended JSON produced, for the run summary
+}
+
+// FilePartition is one period file of a split collection. Bucket is the
+// UTC period (2024, 2024-01 or 2024-01-31), or "undated" for documents
+// without a usable date.
+type FilePartition struct {
+	Bucket string `json:"bucket"`
+	File   string `json:"file"`
+	Docs   int64  `json:"docs"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// CountCheck compares the documents written with the live count taken right
+// after the collection finished (--count-check). A non-zero Difference means
+// the collection was written to during the backup.
+type CountCheck struct {
+	Live       int64 `json:"live"`
+	Difference int64 `json:"difference"`
+}
+
+// CountDrift compares the collection's document count (from collection
+// metadata) before and after it was read. Percent is relative to Start.
+type CountDrift struct {
+	Start   int64   `json:"start"`
+	End     int64   `json:"end"`
+	Percent float64 `json:"percent"`
+}
+
+func newCountDrift(start, end int64) *CountDrift {
+	d := end - start
+	if d < 0 {
+		d = -d
+	}
+	base := start
+	if base < 1 {
+		base = 1
+	}
+	return &CountDrift{Start: start, End: end, Percent: math.Round(float64(d)*10000/float64(base)) / 100}
+}
+
+// ManifestFilters records the client-side document filtering of a run, so a
+// reader knows the backup is not a verbatim copy.
+type ManifestFilters struct {
+	DropFields    []string           `json:"dropFields,omitempty"`
+	MaxFieldBytes int64              `json:"maxFieldBytes,omitempty"`
+	LimitTotal    int64              `json:"limitTotal,omitempty"`
+	Age           *ManifestAgeFilter `json:"age,omitempty"`
+
+	// NumbersAsStrings: int64 beyond ±(2^53-1) and Decimal128 are strings.
+	NumbersAsStrings bool `json:"numbersAsStrings,omitempty"`
+
+	// DropFieldsRegex removed matching field names; Recursive: at any depth.
+	DropFieldsRegex string `json:"dropFieldsRegex,omitempty"`
+	Recursive       bool   `json:"recursive,omitempty"`
+
+	// Query is the --query filter as given.
+	Query string `json:"query,omitempty"`
+
+	// Fields is the --fields projection: kept fields, or -dropped ones.
+	Fields []string `json:"fields,omitempty"`
+
+	// Redact lists the --redact paths removed from every document.
+	Redact []string `json:"redact,omitempty"`
+}
+
+// ManifestAgeFilter records the rolling window applied by --max-age.
+type ManifestAgeFilter struct {
+	MaxAge string    `json:"maxAge"`
+	Field  string    `json:"field"`
+	Cutoff time.Time `json:"cutoff"`
+}
+
+// CollectionValidator is the document validation setup of a collection,
+// kept so it can be recreated before documents are loaded back.
+type CollectionValidator struct {
+	Validator json.RawMessage `json:"validator"`
+	Level     string          `json:"validationLevel,omitempty"`
+	Action    string          `json:"validationAction,omitempty"`
+}
+
+// CollectionStats holds the metrics gathered while writing a collection
+// (only recorded with --dump-stats).
+type CollectionStats struct {
+	Bytes       int64   `json:"bytes"`
+	DurationMS  int64   `json:"durationMs"`
+	AvgDocBytes float64 `json:"avgDocBytes"`
+	DocsPerSec  float64 `json:"docsPerSec"`
+}
+
+// validatorFromOptions extracts the validator from a collection's
+// listCollections options. It returns nil when none is configured.
+func validatorFromOptions(opts bson.Raw) (*CollectionValidator, error) {
+	if len(opts) == 0 {
+		return nil, nil
+	}
+	val, err := opts.LookupErr("validator")
+	if err != nil {
+		return nil, nil
+	}
+	doc, ok := val.DocumentOK()
+	if !ok {
+		return nil, fmt.Errorf("unexpected validator type %s", val.Type)
+	}
+	ext, err := bson.MarshalExtJSON(doc, false, false)
+	if err != nil {
+		return nil, err
+	}
+	v := &CollectionValidator{Validator: ext}
+	if lvl, ok := opts.Lookup("validationLevel").StringValueOK(); ok {
+		v.Level = lvl
+	}
+	if act, ok := opts.Lookup("validationAction").StringValueOK(); ok {
+		v.Action = act
+	}
+	return v, nil
+}
+
+// creationOptions returns the listCollections options that shape a
+// collection when it is created (capped size, collation, time-series spec,
+// clustered index and so on), without the validator recorded separately.
+// It returns nil when the collection has default options.
+func creationOptions(opts bson.Raw) (json.RawMessage, error) {
+	elems, err := opts.Elements()
+	if err != nil {
+		return nil, err
+	}
+	var keep bson.D
+	for _, e := range elems {
+		switch e.Key() {
+		case "validator", "validationLevel", "validationAction":
+			continue
+		}
+		keep = append(keep, bson.E{Key: e.Key(), Value: e.Value()})
+	}
+	if len(keep) == 0 {
+		return nil, nil
+	}
+	return bson.MarshalExtJSON(keep, false, false)
+}
+
+// preAndPostImages reports whether a collection's listCollections options
+// enable changeStreamPreAndPostImages.
+func preAndPostImages(opts bson.Raw) bool {
+	enabled, ok := opts.Lookup("changeStreamPreAndPostImages", "enabled").BooleanOK()
+	return ok && enabled
+}
+
+func newCollectionStats(docs, bytes int64, elapsed time.Duration) *CollectionStats {
+	st := &CollectionStats{
+		Bytes:      bytes,
+		DurationMS: elapsed.Milliseconds(),
+	}
+	if docs > 0 {
+		st.AvgDocBytes = float64(bytes) / float64(docs)
+	}
+	if secs := elapsed.Seconds(); secs > 0 {
+		st.DocsPerSec = float64(docs) / secs
+	}
+	return st
+}
+
+// manifestPath returns where the manifest for a given output lives:
+// inside the directory, or as "<file>.manifest.json" for merged output.
+func manifestPath(output string, isDir bool) string {
+	if isDir {
+		return filepath.Join(output, "manifest.json")
+	}
+	return outputStem(output) + ".manifest.json"
+}
+
+// outputStem is a merged output path without its extension, ".jsonl.gz"
+// counting as one, for naming the files written next to it.
+func outputStem(output string) string {
+	output = strings.TrimSuffix(output, ".gz")
+	return strings.TrimSuffix(output, filepath.Ext(output))
+}
+
+func readManifest(path string) (Manifest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Manifest{}, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return Manifest{}, fmt.Errorf("parse manifest %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// isManifestFile reports whether a file name is one written by writeManifest.
+func isManifestFile(name string) bool {
+	return name == "manifest.json" || strings.HasSuffix(name, ".manifest.json")
+}
+
+// dataFiles lists the files holding the collection's documents: its
+// partitions, else File. An --output-split-by-date collection without
+// documents has neither, and the list is empty.
+func (c CollectionManifest) dataFiles() []string {
+	if len(c.Partitions) == 0 {
+		if c.File == "" {
+			return nil
+		}
+		return []string{c.File}
+	}
+	files := make([]string, 0, len(c.Partitions))
+	for _, p := range c.Partitions {
+		files = append(files, p.File)
+	}
+	return files
+}
+
+func writeManifest(path string, m Manifest) error {
+	return writeJSONFile(path, m)
+}
+
+// FileIndexEntry addresses one collection's output file in index.json.
+type FileIndexEntry struct {
+	File     string `json:"file"`
+	DocCount int64  `json:"docCount"`
+	Bytes    int64  `json:"bytes"`
+	SHA256   string `json:"sha256"`
+}
+
+// writeFileIndex writes the combined collection -> file index of a
+// directory backup.
+func writeFileIndex(dir string, colls []CollectionManifest) error {
+	idx := make(map[string]FileIndexEntry, len(colls))
+	for _, c := range colls {
+		idx[c.Name] = FileIndexEntry{File: c.File, DocCount: c.Docs, Bytes: c.Bytes, SHA256: c.SHA256}
+	}
+	return writeJSONFile(filepath.Join(dir, "index.json"), idx)
+}
+
+// writeJSONFile writes v as indented JSON via a temp file and rename, so a
+// crash never leaves a truncated file behind.
+func writeJSONFile(path string, v interface{}) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxSafeInteger is the largest integer a float64 (and so JavaScript and
+// most JSON loaders) represents exactly: 2^53 - 1.
+const maxSafeInteger = 1<<53 - 1
+
+// stringifyNumbers returns a copy of doc in which int64 values outside
+// ±(2^53-1) and all Decimal128 values are replaced by their decimal string,
+// at any depth, plus the number of values replaced. doc itself is not
+// modified.
+func stringifyNumbers(doc bson.M) (bson.M, int) {
+	out, n := stringifyValue(doc)
+	return out.(bson.M), n
+}
+
+func stringifyValue(v interface{}) (interface{}, int) {
+	switch x := v.(type) {
+	case int64:
+		if x > maxSafeInteger || x < -maxSafeInteger {
+			return strconv.FormatInt(x, 10), 1
+		}
+	case primitive.Decimal128:
+		return x.String(), 1
+	case bson.M:
+		out := make(bson.M, len(x))
+		total := 0
+		for k, e := range x {
+			var n int
+			out[k], n = stringifyValue(e)
+			total += n
+		}
+		return out, total
+	case bson.D:
+		out := make(bson.D, len(x))
+		total := 0
+		for i, e := range x {
+			val, n := stringifyValue(e.Value)
+			out[i] = bson.E{Key: e.Key, Value: val}
+			total += n
+		}
+		return out, total
+	case bson.A:
+		out := make(bson.A, len(x))
+		total := 0
+		for i, e := range x {
+			var n int
+			out[i], n = stringifyValue(e)
+			total += n
+		}
+		return out, total
+	}
+	return v, 0
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// collResult is the outcome of one collection backed up by a worker.
+type collResult struct {
+	name  string
+	entry CollectionManifest
+	err   error
+}
+
+// backupParallel backs up colls with n concurrent workers (--parallel), each
+// with its own cursor and output file. Collections are handed out in listing
+// order until stop reports the time is up. finished runs on the calling
+// goroutine for each collection as it completes; the first error it returns
+// cancels the other workers, which are waited for so their files are flushed
+// and closed.
+//
+// It returns the index of the first collection never started, the entries
+// of the collections cut off by the cancellation, and finished's error.
+func (r *backupRun) backupParallel(ctx context.Context, colls []string, n int, stop func() bool,
+	finished func(string, CollectionManifest, error) error) (int, []CollectionManifest, error) {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int)
+	results := make(chan collResult)
+	var wg sync.WaitGroup
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				entry, err := r.backupCollection(wctx, colls[i], i+1)
+				results <- collResult{name: colls[i], entry: entry, err: err}
+			}
+		}()
+	}
+
+	dispatched := make(chan int, 1)
+	go func() {
+		defer close(jobs)
+		i := 0
+		defer func() { dispatched <- i }()
+		for ; i < len(colls) && !stop(); i++ {
+			select {
+			case jobs <- i:
+			case <-wctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var runErr error
+	var cut []CollectionManifest
+	for res := range results {
+		if runErr != nil {
+			if res.err != nil {
+				res.entry.Name = res.name
+				cut = append(cut, res.entry)
+			}
+			continue
+		}
+		if err := finished(res.name, res.entry, res.err); err != nil {
+			runErr = err
+			cancel()
+		}
+	}
+	return <-dispatched, cut, runErr
+}
+
+// sortByListing puts manifest entries back in collection listing order after
+// --parallel workers finished them in completion order.
+func sortByListing(entries []CollectionManifest, colls []string) {
+	pos := make(map[string]int, len(colls))
+	for i, c := range colls {
+		pos[c] = i
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return pos[entries[i].Name] < pos[entries[j].Name] })
+}
+
+// restoreResult is the outcome of one collection restored by a worker.
+type restoreResult struct {
+	batch *restoreBatch
+	err   error
+}
+
+// restoreParallel restores sources with n concurrent workers (restore
+// --parallel), each loading one collection's files. Collections are handed
+// out in order; finished runs on the calling goroutine for each one as it
+// completes, and the first error it returns cancels the other workers,
+// which are waited for before restoreParallel returns that error.
+func (r *restoreRun) restoreParallel(ctx context.Context, sources []restoreFile, n int,
+	finished func(*restoreBatch, error) error) error {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan restoreFile)
+	results := make(chan restoreResult)
+	var wg sync.WaitGroup
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for src := range jobs {
+				b, err := r.restoreSource(wctx, src)
+				results <- restoreResult{batch: b, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, src := range sources {
+			select {
+			case jobs <- src:
+			case <-wctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var runErr error
+	for res := range results {
+		if runErr != nil {
+			continue
+		}
+		if err := finished(res.batch, res.err); err != nil {
+			runErr = err
+			cancel()
+		}
+	}
+	return runErr
+}
+
+// buildIndexesParallel runs restoreIndexes for jobs with n concurrent
+// workers (restore --defer-indexes). The first error cancels the builds not
+// yet started and is returned once the running ones finish.
+func buildIndexesParallel(ctx context.Context, jobs []indexJob, n int) error {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan indexJob)
+	errs := make(chan error, len(jobs))
+	var wg sync.WaitGroup
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				if err := restoreIndexes(wctx, job.coll, job.path); err != nil {
+					errs <- fmt.Errorf("indexes %s: %w", job.coll.Name(), err)
+					cancel()
+				}
+			}
+		}()
+	}
+dispatch:
+	for _, job := range jobs {
+		select {
+		case queue <- job:
+		case <-wctx.Done():
+			break dispatch
+		}
+	}
+	close(queue)
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxOpenPartitions bounds the files a split collection keeps open; the
+// least recently written one is closed (and later reopened for append)
+// when a new bucket needs a file.
+const maxOpenPartitions = 32
+
+// undatedBucket collects documents whose time field is missing or not a date.
+const undatedBucket = "undated"
+
+// splitLayouts maps each --output-split-by-date period to the time layout
+// naming its buckets.
+var splitLayouts = map[string]string{"year": "2006", "month": "2006-01", "day": "2006-01-02"}
+
+// dateSplit routes documents to per-period files (--output-split-by-date).
+type dateSplit struct {
+	period string // year, month or day
+	layout string // time layout naming a bucket, e.g. 2006-01
+	field  string // date field; "" = the ObjectID _id timestamp
+}
+
+func parseDateSplit(period, field string) (*dateSplit, error) {
+	layout, ok := splitLayouts[period]
+	if !ok {
+		return nil, fmt.Errorf("invalid --output-split-by-date %q (want year, month or day)", period)
+	}
+	return &dateSplit{period: period, layout: layout, field: field}, nil
+}
+
+// bucket names the period of a document, in UTC.
+func (s *dateSplit) bucket(doc bson.M) string {
+	var t time.Time
+	if s.field == "" {
+		id, ok := doc["_id"].(primitive.ObjectID)
+		if !ok {
+			return undatedBucket
+		}
+		t = id.Timestamp()
+	} else {
+		switch v := doc[s.field].(type) {
+		case primitive.DateTime:
+			t = v.Time()
+		case primitive.Timestamp:
+			t = time.Unix(int64(v.T), 0)
+		default:
+			return undatedBucket
+		}
+	}
+	return t.UTC().Format(s.layout)
+}
+
+// isBucketName reports whether s is a bucket name of any period.
+func isBucketName(s string) bool {
+	if s == undatedBucket {
+		return true
+	}
+	for _, layout := range splitLayouts {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// partitionSet holds the JSON Lines files of one split collection.
+type partitionSet struct {
+	dir   string
+	name  func(bucket string) string // file name of a bucket
+	mode  os.FileMode
+	fsync bool
+
+	// gzip compresses every file (--gzip). A reopened file gets a new gzip
+	// member appended, which gzip readers join.
+	gzip            bool
+	gzipLevel       int
+	compressThreads int
+
+	parts map[string]*partition
+	open  int
+	tick  int
+}
+
+type partition struct {
+	file string
+	docs int64
+	f    *os.File
+	bw   *bufio.Writer
+	zw   io.WriteCloser
+	used int // tick of the last write, for closing the least recent
+}
+
+func newPartitionSet(dir string, name func(string) string, mode os.FileMode, fsync bool) *partitionSet {
+	return &partitionSet{dir: dir, name: name, mode: mode, fsync: fsync, parts: map[string]*partition{}}
+}
+
+// forDoc returns the writer of bucket for one more document, opening (or
+// reopening) its file as needed.
+func (ps *partitionSet) forDoc(bucket string) (io.Writer, error) {
+	p := ps.parts[bucket]
+	if p == nil {
+		p = &partition{file: ps.name(bucket)}
+		ps.parts[bucket] = p
+	}
+	if p.f == nil {
+		if ps.open >= maxOpenPartitions {
+			if err := ps.closeLeastRecent(); err != nil {
+				return nil, err
+			}
+		}
+		path := filepath.Join(ps.dir, p.file)
+		var err error
+		if p.docs == 0 {
+			p.f, err = createFile(path, ps.mode)
+		} else {
+			p.f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.bw = bufio.NewWriterSize(p.f, 256<<10)
+		if ps.gzip {
+			if p.zw, err = newGzipWriter(p.bw, ps.gzipLevel, ps.compressThreads); err != nil {
+				_ = p.f.Close()
+				p.f, p.bw = nil, nil
+				return nil, err
+			}
+		}
+		ps.open++
+	}
+	ps.tick++
+	p.used = ps.tick
+	p.docs++
+	if p.zw != nil {
+		return p.zw, nil
+	}
+	return p.bw, nil
+}
+
+func (ps *partitionSet) closeLeastRecent() error {
+	var lru *partition
+	for _, p := range ps.parts {
+		if p.f != nil && (lru == nil || p.used < lru.used) {
+			lru = p
+		}
+	}
+	if lru == nil {
+		return nil
+	}
+	return ps.closePart(lru, ps.fsync)
+}
+
+func (ps *partitionSet) closePart(p *partition, sync bool) error {
+	var err error
+	if p.zw != nil {
+		err = p.zw.Close()
+	}
+	if ferr := p.bw.Flush(); ferr != nil && err == nil {
+		err = ferr
+	}
+	if sync && err == nil {
+		err = p.f.Sync()
+	}
+	if cerr := p.f.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	p.f, p.bw, p.zw = nil, nil, nil
+	ps.open--
+	return err
+}
+
+// close flushes every open file (syncing with --fsync) and returns the
+// partitions sorted by bucket.
+func (ps *partitionSet) close() ([]FilePartition, error) {
+	var err error
+	out := make([]FilePartition, 0, len(ps.parts))
+	for bucket, p := range ps.parts {
+		if p.f != nil {
+			if cerr := ps.closePart(p, ps.fsync); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+		part := FilePartition{Bucket: bucket, File: p.file, Docs: p.docs}
+		// A reopened file was appended to, so its size is only known on disk.
+		if fi, serr := os.Stat(filepath.Join(ps.dir, p.file)); serr == nil {
+			part.Bytes = fi.Size()
+		}
+		out = append(out, part)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Bucket < out[j].Bucket })
+	return out, err
+}
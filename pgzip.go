@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// pgzipBlockSize is the amount of uncompressed output each --compress-threads
+// worker compresses at a time.
+const pgzipBlockSize = 1 << 20
+
+// newGzipWriter returns the --gzip compressor writing to w: a plain
+// gzip.Writer with threads <= 1, else a parallelGzip.
+func newGzipWriter(w io.Writer, level, threads int) (io.WriteCloser, error) {
+	if threads <= 1 {
+		return gzip.NewWriterLevel(w, level)
+	}
+	// Rejects a bad level up front rather than in the first worker.
+	if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+		return nil, err
+	}
+	z := &parallelGzip{w: w, level: level, queue: make(chan chan pgzipBlock, threads), done: make(chan struct{})}
+	go z.drain()
+	return z, nil
+}
+
+// parallelGzip compresses blocks of pgzipBlockSize bytes concurrently, up
+// to cap(queue) at a time, each as a complete gzip member. The members are
+// written in order, so the output is one multi-member gzip file that gzip
+// readers (gunzip, compress/gzip, restore) read as a single stream.
+type parallelGzip struct {
+	w      io.Writer
+	level  int
+	buf    []byte
+	n      int // blocks submitted
+	closed bool
+
+	queue chan chan pgzipBlock // results in output order; its capacity bounds the workers
+	done  chan struct{}        // closed when drain returns
+
+	mu  sync.Mutex
+	err error // first compression or write error
+}
+
+type pgzipBlock struct {
+	data []byte
+	err  error
+}
+
+func (z *parallelGzip) Write(p []byte) (int, error) {
+	if err := z.failed(); err != nil {
+		return 0, err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		if z.buf == nil {
+			z.buf = make([]byte, 0, pgzipBlockSize)
+		}
+		k := copy(z.buf[len(z.buf):cap(z.buf)], p)
+		z.buf = z.buf[:len(z.buf)+k]
+		p = p[k:]
+		if len(z.buf) == cap(z.buf) {
+			z.submit()
+		}
+	}
+	return n, nil
+}
+
+// submit hands the buffered block to a new worker, waiting while cap(queue)
+// blocks are still being compressed or written.
+func (z *parallelGzip) submit() {
+	data := z.buf
+	z.buf = nil
+	z.n++
+	res := make(chan pgzipBlock, 1)
+	z.queue <- res
+	go func() {
+		var out bytes.Buffer
+		zw, err := gzip.NewWriterLevel(&out, z.level)
+		if err == nil {
+			_, err = zw.Write(data)
+		}
+		if err == nil {
+			err = zw.Close()
+		}
+		res <- pgzipBlock{data: out.Bytes(), err: err}
+	}()
+}
+
+// drain writes the compressed blocks to w in submission order.
+func (z *parallelGzip) drain() {
+	defer close(z.done)
+	for res := range z.queue {
+		b := <-res
+		if z.failed() != nil {
+			continue
+		}
+		err := b.err
+		if err == nil {
+			_, err = z.w.Write(b.data)
+		}
+		if err != nil {
+			z.mu.Lock()
+			z.err = err
+			z.mu.Unlock()
+		}
+	}
+}
+
+func (z *parallelGzip) failed() error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.err
+}
+
+// Close compresses what is buffered, waits for every block to be written
+// and returns the first error. An empty stream still gets one (empty) gzip
+// member, so the file is valid gzip. Closing twice is a no-op.
+func (z *parallelGzip) Close() error {
+	if z.closed {
+		return z.failed()
+	}
+	z.closed = true
+	if len(z.buf) > 0 || z.n == 0 {
+		z.submit()
+	}
+	close(z.queue)
+	<-z.done
+	return z.failed()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParallelGzipRoundtrip(t *testing.T) {
+	line := strings.Repeat(`{"_id":{"$oid":"65b0d1e2f3a4b5c6d7e8f901"},"n":12345}`, 3) + "\n"
+	for _, size := range []int{0, 10, pgzipBlockSize, 5*pgzipBlockSize + 77} {
+		var want bytes.Buffer
+		for want.Len() < size {
+			want.WriteString(line)
+		}
+		want.Truncate(size)
+
+		var out bytes.Buffer
+		zw, err := newGzipWriter(&out, gzip.BestSpeed, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Odd-sized writes straddle the block boundaries.
+		for p := want.Bytes(); len(p) > 0; {
+			k := len(p)
+			if k > 70001 {
+				k = 70001
+			}
+			if _, err := zw.Write(p[:k]); err != nil {
+				t.Fatal(err)
+			}
+			p = p[k:]
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Errorf("size %d: second Close: %v", size, err)
+		}
+
+		zr, err := gzip.NewReader(&out)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		got, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(got, want.Bytes()) {
+			t.Errorf("size %d: read back %d bytes that differ from the %d written", size, len(got), want.Len())
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestParallelGzipWriteError(t *testing.T) {
+	zw, err := newGzipWriter(failingWriter{}, gzip.DefaultCompression, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = zw.Write(make([]byte, 3*pgzipBlockSize))
+	if err := zw.Close(); err == nil || err.Error() != "disk full" {
+		t.Errorf("Close = %v, want the write error", err)
+	}
+	if _, err := newGzipWriter(io.Discard, 42, 2); err == nil {
+		t.Error("newGzipWriter accepted level 42")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// progressSnapshot is the machine-readable progress state written by
+// --progress-file.
+type progressSnapshot struct {
+	State           string    `json:"state"`
+	DB              string    `json:"db"`
+	Collection      string    `json:"collection"`
+	CollectionIndex int       `json:"collectionIndex"`
+	Collections     int       `json:"collections"`
+	DocsDone        int64     `json:"docsDone"`
+	DocsTotal       int64     `json:"docsTotal"`
+	Percent         float64   `json:"percent"`
+	DocsPerSec      float64   `json:"docsPerSec"`
+	ETASeconds      float64   `json:"etaSeconds"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+// progressTracker follows the collection currently being backed up. All
+// methods are safe to call on a nil tracker, which does nothing.
+type progressTracker struct {
+	path     string
+	interval time.Duration
+
+	mu        sync.Mutex
+	snap      progressSnapshot
+	collStart time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newProgressTracker(path, db string, collections int, interval time.Duration) *progressTracker {
+	if path == "" {
+		return nil
+	}
+	return &progressTracker{
+		path:     path,
+		interval: interval,
+		snap:     progressSnapshot{State: "running", DB: db, Collections: collections},
+	}
+}
+
+// start launches the periodic writer.
+func (p *progressTracker) start() {
+	if p == nil {
+		return
+	}
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+		t := time.NewTicker(p.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				p.flush()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// finish stops the writer and records the final state.
+func (p *progressTracker) finish(state string) {
+	if p == nil {
+		return
+	}
+	if p.stop != nil {
+		close(p.stop)
+		<-p.done
+	}
+	p.mu.Lock()
+	p.snap.State = state
+	p.mu.Unlock()
+	p.flush()
+}
+
+func (p *progressTracker) startCollection(name string, index int, total int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.snap.Collection = name
+	p.snap.CollectionIndex = index
+	p.snap.DocsDone = 0
+	p.snap.DocsTotal = total
+	p.collStart = time.Now()
+	p.mu.Unlock()
+}
+
+func (p *progressTracker) add(n int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.snap.DocsDone += n
+	p.mu.Unlock()
+}
+
+func (p *progressTracker) snapshot() progressSnapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.snap
+	s.UpdatedAt = time.Now().UTC()
+	if s.DocsTotal > 0 {
+		s.Percent = 100 * float64(s.DocsDone) / float64(s.DocsTotal)
+	}
+	if secs := time.Since(p.collStart).Seconds(); secs > 0 && !p.collStart.IsZero() {
+		s.DocsPerSec = float64(s.DocsDone) / secs
+	}
+	if s.DocsPerSec > 0 && s.DocsTotal > s.DocsDone {
+		s.ETASeconds = float64(s.DocsTotal-s.DocsDone) / s.DocsPerSec
+	}
+	return s
+}
+
+// flush overwrites the progress file atomically so readers never see a
+// partial document.
+func (p *progressTracker) flush() {
+	b, err := json.Marshal(p.snapshot())
+	if err != nil {
+		return
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: progress file: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmp, p.path); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: progress file: %v\n", err)
+	}
+}
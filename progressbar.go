@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	barWidth        = 30
+	barRedraw       = 100 * time.Millisecond
+	barLineInterval = 5 * time.Second
+)
+
+// progressBar draws the per-collection --progress-bar. On a terminal it
+// redraws one line in place with carriage returns; when stdout is
+// redirected it falls back to a plain progress line every few seconds.
+// All methods are safe to call on a nil bar, which does nothing.
+type progressBar struct {
+	out  io.Writer
+	tty  bool
+	name string
+
+	done, total int64
+	last        time.Time
+	drawn       bool // a bar line is open and needs finish
+}
+
+func newProgressBar(enabled bool) *progressBar {
+	if !enabled {
+		return nil
+	}
+	return &progressBar{out: os.Stdout, tty: term.IsTerminal(int(os.Stdout.Fd()))}
+}
+
+// start begins a bar for a collection; total is an estimate and may be 0.
+func (b *progressBar) start(name string, total int64) {
+	if b == nil {
+		return
+	}
+	b.name, b.done, b.total = name, 0, total
+	b.last = time.Now()
+}
+
+func (b *progressBar) add(n int64) {
+	if b == nil {
+		return
+	}
+	b.done += n
+	interval := barLineInterval
+	if b.tty {
+		interval = barRedraw
+	}
+	if time.Since(b.last) < interval {
+		return
+	}
+	b.last = time.Now()
+	if b.tty {
+		b.draw()
+	} else {
+		fmt.Fprintf(b.out, "%s: %s\n", b.name, b.counts())
+	}
+}
+
+// finish draws the final state and ends the bar's line. It is a no-op when
+// nothing was drawn since start.
+func (b *progressBar) finish() {
+	if b == nil || !b.drawn {
+		return
+	}
+	if b.done > b.total {
+		b.total = b.done
+	}
+	b.draw()
+	fmt.Fprintln(b.out)
+	b.drawn = false
+}
+
+func (b *progressBar) draw() {
+	filled := 0
+	if b.total > 0 {
+		filled = int(min(b.done, b.total) * barWidth / b.total)
+	}
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", barWidth-filled)
+	fmt.Fprintf(b.out, "\r%s [%s] %s\033[K", b.name, bar, b.counts())
+	b.drawn = true
+}
+
+func (b *progressBar) counts() string {
+	if b.total <= 0 {
+		return fmt.Sprintf("%d docs", b.done)
+	}
+	pct := 100 * float64(min(b.done, b.total)) / float64(b.total)
+	return fmt.Sprintf("%3.0f%% %d/%d docs", pct, b.done, b.total)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const progressLineInterval = time.Second
+
+// progressLine is the default progress report of a collection: once a
+// second it writes a line with the documents done out of the estimated
+// total and the time remaining at the rate so far. It goes to stderr, so
+// stdout stays parseable; --quiet turns it off and --progress-bar replaces
+// it. Each collection has its own, so --parallel workers do not share one.
+// All methods are safe to call on a nil progressLine, which does nothing.
+type progressLine struct {
+	out   io.Writer
+	name  string
+	total int64 // estimated document count; 0 = unknown
+	done  int64
+	start time.Time
+	last  time.Time
+}
+
+func newProgressLine(name string, total int64) *progressLine {
+	now := time.Now()
+	return &progressLine{out: os.Stderr, name: name, total: total, start: now, last: now}
+}
+
+func (p *progressLine) add(n int64) {
+	if p == nil {
+		return
+	}
+	p.done += n
+	now := time.Now()
+	if now.Sub(p.last) < progressLineInterval {
+		return
+	}
+	p.last = now
+	fmt.Fprintf(p.out, "%s: %s\n", p.name, p.status(now.Sub(p.start)))
+}
+
+// status formats the counts, rate and ETA after elapsed. The ETA is left out
+// while the total is unknown or already exceeded (the estimate is stale).
+func (p *progressLine) status(elapsed time.Duration) string {
+	rate := float64(p.done) / elapsed.Seconds()
+	if p.total <= 0 || p.done >= p.total || rate <= 0 {
+		return fmt.Sprintf("%d docs, %.0f docs/s", p.done, rate)
+	}
+	eta := time.Duration(float64(p.total-p.done) / rate * float64(time.Second))
+	pct := 100 * float64(p.done) / float64(p.total)
+	return fmt.Sprintf("%d/%d docs (%.0f%%), %.0f docs/s, ETA %s", p.done, p.total, pct, rate, eta.Round(time.Second))
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+func stdinIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// promptLine asks a question on stderr and returns the trimmed answer,
+// or def when the answer is empty.
+func promptLine(label, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(os.Stderr, "%s [%s]: ", label, def)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: ", label)
+	}
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+// promptPassword reads a secret from the terminal without echo.
+func promptPassword(label string) (string, error) {
+	fmt.Fprintf(os.Stderr, "%s: ", label)
+	b, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// promptConnect interactively collects a URI and default database. When the
+// URI carries no credentials, the username and (hidden) password are asked
+// for separately and injected into the URI; without savePassword only the
+// username is (--prompt-password asks for the password on each connection).
+func promptConnect(savePassword bool) (uri, db string, err error) {
+	uri, err = promptLine("MongoDB URI", "mongodb://localhost:27017")
+	if err != nil {
+		return "", "", err
+	}
+	if !uriHasUserInfo(uri) {
+		user, err := promptLine("Username (empty for none)", "")
+		if err != nil {
+			return "", "", err
+		}
+		if user != "" {
+			ui := url.User(user)
+			if savePassword {
+				pass, err := promptPassword("Password")
+				if err != nil {
+					return "", "", err
+				}
+				ui = url.UserPassword(user, pass)
+			}
+			uri, err = withUserInfo(uri, ui)
+			if err != nil {
+				return "", "", err
+			}
+		}
+	}
+	db, err = promptLine("Default database", "")
+	if err != nil {
+		return "", "", err
+	}
+	if db == "" {
+		return "", "", errors.New("a default database is required")
+	}
+	return uri, db, nil
+}
+
+// uriHasUserInfo reports whether a mongodb:// URI contains "user@" before the
+// host list.
+func uriHasUserInfo(uri string) bool {
+	_, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return false
+	}
+	hosts, _, _ := strings.Cut(rest, "/")
+	return strings.Contains(hosts, "@")
+}
+
+// withUserInfo inserts escaped credentials into a URI. It works on the raw
+// string because multi-host URIs are not valid for net/url.
+func withUserInfo(uri string, ui *url.Userinfo) (string, error) {
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return "", fmt.Errorf("invalid URI %q (expected mongodb:// or mongodb+srv://)", uri)
+	}
+	return scheme + "://" + ui.String() + "@" + rest, nil
+}
+
+// uriUser returns the (unescaped) username of a mongodb:// URI and whether
+// the URI also carries a non-empty password.
+func uriUser(uri string) (user string, hasPassword bool) {
+	_, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return "", false
+	}
+	hosts, _, _ := strings.Cut(rest, "/")
+	at := strings.LastIndex(hosts, "@")
+	if at < 0 {
+		return "", false
+	}
+	user, pass, _ := strings.Cut(hosts[:at], ":")
+	if u, err := url.PathUnescape(user); err == nil {
+		user = u
+	}
+	return user, pass != ""
+}
+
+// withPassword replaces the credentials of a URI with its username and
+// pass.
+func withPassword(uri, pass string) (string, error) {
+	user, _ := uriUser(uri)
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return "", fmt.Errorf("invalid URI %q (expected mongodb:// or mongodb+srv://)", uri)
+	}
+	hosts, _, _ := strings.Cut(rest, "/")
+	if at := strings.LastIndex(hosts, "@"); at >= 0 {
+		rest = rest[at+1:]
+	}
+	return withUserInfo(scheme+"://"+rest, url.UserPassword(user, pass))
+}
+
+// sessionPasswords holds the passwords asked for in this process, by URI, so
+// a command connecting twice prompts only once.
+var sessionPasswords = map[string]string{}
+
+// sessionPassword returns the password of a profile saved with
+// --prompt-password. It is never stored: $MONGOBAK_PASSWORD supplies it to
+// unattended runs, otherwise it is read from the terminal without echo.
+func sessionPassword(uri, user string) (string, error) {
+	if pass, ok := sessionPasswords[uri]; ok {
+		return pass, nil
+	}
+	pass := os.Getenv("MONGOBAK_PASSWORD")
+	if pass == "" {
+		if !stdinIsTerminal() {
+			return "", fmt.Errorf("password of %s is not saved: run from a terminal or set MONGOBAK_PASSWORD", user)
+		}
+		var err error
+		if pass, err = promptPassword("Password for " + user); err != nil {
+			return "", err
+		}
+	}
+	sessionPasswords[uri] = pass
+	return pass, nil
+}
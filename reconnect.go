@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxReconnectWait = 30 * time.Second
+
+// reconnector rebuilds the client after a network error broke a cursor
+// (--on-network-error reconnect), for outages the driver's own retry does
+// not ride out, such as a full cluster restart. A nil reconnector is off.
+type reconnector struct {
+	opts     *options.ClientOptions
+	client   *mongo.Client
+	attempts int // connection attempts per outage
+	rebuilt  int // clients built so far
+	streak   int // rebuilds since a document was last read
+}
+
+func newReconnector(client *mongo.Client, opts *options.ClientOptions, mode string, attempts int) *reconnector {
+	if mode != "reconnect" {
+		return nil
+	}
+	return &reconnector{opts: opts, client: client, attempts: attempts}
+}
+
+// current returns the client to use: the last one rebuilt, or fallback
+// while there was no rebuild (or reconnecting is off).
+func (rc *reconnector) current(fallback *mongo.Client) *mongo.Client {
+	if rc == nil || rc.rebuilt == 0 {
+		return fallback
+	}
+	return rc.client
+}
+
+// lost reports whether err is a network error that a new client may fix.
+// After attempts rebuilds without reading a document it gives up, so a
+// server that accepts connections but keeps dropping them is not retried
+// forever.
+func (rc *reconnector) lost(ctx context.Context, err error) bool {
+	return rc != nil && ctx.Err() == nil && mongo.IsNetworkError(err) && rc.streak < rc.attempts
+}
+
+// ok records that a document was read since the last rebuild.
+func (rc *reconnector) ok() {
+	if rc != nil {
+		rc.streak = 0
+	}
+}
+
+// rebuild drops the current client and connects a new one with the same
+// options, backing off between attempts. Each attempt is logged.
+func (rc *reconnector) rebuild(ctx context.Context, cause error) (*mongo.Client, error) {
+	fmt.Fprintf(os.Stderr, "Warning: network error: %v; rebuilding the client\n", cause)
+	dctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	_ = rc.client.Disconnect(dctx)
+	cancel()
+
+	wait := time.Second
+	err := cause
+	for i := 1; i <= rc.attempts; i++ {
+		var c *mongo.Client
+		if c, err = mongo.Connect(ctx, rc.opts); err == nil {
+			if err = c.Ping(ctx, nil); err == nil {
+				rc.client = c
+				rc.rebuilt++
+				rc.streak++
+				fmt.Printf("Reconnected (attempt %d/%d, reconnection %d)\n", i, rc.attempts, rc.rebuilt)
+				return c, nil
+			}
+			_ = c.Disconnect(context.Background())
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		fmt.Fprintf(os.Stderr, "Reconnect attempt %d/%d failed: %v\n", i, rc.attempts, err)
+		if i == rc.attempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		if wait *= 2; wait > maxReconnectWait {
+			wait = maxReconnectWait
+		}
+	}
+	return nil, fmt.Errorf("reconnect failed after %d attempts: %w", rc.attempts, err)
+}
+
+// close disconnects a client built by rebuild; the original one is closed
+// by whoever connected it.
+func (rc *reconnector) close() {
+	if rc == nil || rc.rebuilt == 0 {
+		return
+	}
+	_ = rc.client.Disconnect(context.Background())
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestReconnectorCurrentWithoutRebuild(t *testing.T) {
+	fallback := &mongo.Client{}
+	var off *reconnector
+	if got := off.current(fallback); got != fallback {
+		t.Errorf("nil reconnector: current = %p, want the fallback", got)
+	}
+	rc := newReconnector(fallback, options.Client(), "reconnect", 3)
+	if got := rc.current(fallback); got != fallback {
+		t.Errorf("no rebuild yet: current = %p, want the fallback", got)
+	}
+}
+
+// TestReconnectorAcrossDatabases backs two databases with one reconnector,
+// as --all-databases does, and rebuilds the client after the first: the
+// second must get the new client, since the rebuild disconnected the old one.
+// It needs a server: set MONGOBAK_TEST_URI.
+func TestReconnectorAcrossDatabases(t *testing.T) {
+	uri := os.Getenv("MONGOBAK_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGOBAK_TEST_URI not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	opts := options.Client().ApplyURI(uri)
+	orig, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = orig.Disconnect(context.Background()) }()
+	rc := newReconnector(orig, opts, "reconnect", 2)
+	defer rc.close()
+
+	for i, name := range []string{"mongobak_test_a", "mongobak_test_b"} {
+		client := rc.current(orig)
+		if i > 0 && client == orig {
+			t.Fatalf("database %s uses the client disconnected by the rebuild", name)
+		}
+		if _, err := client.Database(name).ListCollectionNames(ctx, bson.D{}); err != nil {
+			t.Fatalf("database %s: %v", name, err)
+		}
+		if i == 0 {
+			if _, err := rc.rebuild(ctx, errors.New("simulated network error")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if _, err := orig.ListDatabaseNames(ctx, bson.D{}); !errors.Is(err, mongo.ErrClientDisconnected) {
+		t.Errorf("original client after rebuild: err = %v, want ErrClientDisconnected", err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// parseRedactPaths splits the --redact list into dotted paths. _id cannot
+// be redacted: resuming and incremental runs depend on it.
+func parseRedactPaths(s string) ([][]string, error) {
+	var paths [][]string
+	for _, f := range splitCSV(s) {
+		path := strings.Split(f, ".")
+		for _, seg := range path {
+			if seg == "" {
+				return nil, fmt.Errorf("invalid --redact path %q", f)
+			}
+		}
+		if len(path) == 1 && path[0] == "_id" {
+			return nil, fmt.Errorf("--redact cannot remove _id")
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// redactPath deletes the field at path from v and returns v, which is a new
+// slice when a field was removed from a bson.D, and how many fields were
+// removed. Paths follow MongoDB's dot notation: a segment crossing an array
+// applies to every element, unless it is a numeric index, which picks that
+// element only. Missing fields and whole array elements are left alone.
+func redactPath(v interface{}, path []string) (interface{}, int64) {
+	if len(path) == 0 {
+		return v, 0
+	}
+	key, rest := path[0], path[1:]
+	switch x := v.(type) {
+	case bson.M:
+		sub, ok := x[key]
+		if !ok {
+			return x, 0
+		}
+		if len(rest) == 0 {
+			delete(x, key)
+			return x, 1
+		}
+		sub, n := redactPath(sub, rest)
+		x[key] = sub
+		return x, n
+	case bson.D:
+		for i, e := range x {
+			if e.Key != key {
+				continue
+			}
+			if len(rest) == 0 {
+				return append(x[:i:i], x[i+1:]...), 1
+			}
+			sub, n := redactPath(e.Value, rest)
+			x[i].Value = sub
+			return x, n
+		}
+	case bson.A:
+		if i, err := strconv.Atoi(key); err == nil {
+			if i < 0 || i >= len(x) || len(rest) == 0 {
+				return x, 0
+			}
+			sub, n := redactPath(x[i], rest)
+			x[i] = sub
+			return x, n
+		}
+		var total int64
+		for i, e := range x {
+			sub, n := redactPath(e, path)
+			x[i] = sub
+			total += n
+		}
+		return x, total
+	}
+	return v, 0
+}
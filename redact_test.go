@@ -0,0 +1,154 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRedactPath(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  interface{}
+		path string
+		want interface{}
+		n    int64
+	}{
+		{
+			name: "top-level field of bson.M",
+			doc:  bson.M{"_id": 1, "email": "a@x", "name": "A"},
+			path: "email",
+			want: bson.M{"_id": 1, "name": "A"},
+			n:    1,
+		},
+		{
+			name: "top-level field of bson.D",
+			doc:  bson.D{{Key: "_id", Value: 1}, {Key: "email", Value: "a@x"}, {Key: "name", Value: "A"}},
+			path: "email",
+			want: bson.D{{Key: "_id", Value: 1}, {Key: "name", Value: "A"}},
+			n:    1,
+		},
+		{
+			name: "nested bson.M",
+			doc:  bson.M{"profile": bson.M{"id": bson.M{"ssn": "123", "country": "NL"}}},
+			path: "profile.id.ssn",
+			want: bson.M{"profile": bson.M{"id": bson.M{"country": "NL"}}},
+			n:    1,
+		},
+		{
+			name: "nested bson.D",
+			doc:  bson.D{{Key: "profile", Value: bson.D{{Key: "ssn", Value: "123"}, {Key: "age", Value: 40}}}},
+			path: "profile.ssn",
+			want: bson.D{{Key: "profile", Value: bson.D{{Key: "age", Value: 40}}}},
+			n:    1,
+		},
+		{
+			name: "every element of an array",
+			doc: bson.M{"contacts": bson.A{
+				bson.M{"phone": "1", "kind": "home"},
+				bson.M{"kind": "fax"},
+				bson.D{{Key: "phone", Value: "2"}, {Key: "kind", Value: "work"}},
+			}},
+			path: "contacts.phone",
+			want: bson.M{"contacts": bson.A{
+				bson.M{"kind": "home"},
+				bson.M{"kind": "fax"},
+				bson.D{{Key: "kind", Value: "work"}},
+			}},
+			n: 2,
+		},
+		{
+			name: "numeric array index",
+			doc:  bson.M{"contacts": bson.A{bson.M{"phone": "1"}, bson.M{"phone": "2"}}},
+			path: "contacts.0.phone",
+			want: bson.M{"contacts": bson.A{bson.M{}, bson.M{"phone": "2"}}},
+			n:    1,
+		},
+		{
+			name: "array index out of range",
+			doc:  bson.M{"contacts": bson.A{bson.M{"phone": "1"}}},
+			path: "contacts.3.phone",
+			want: bson.M{"contacts": bson.A{bson.M{"phone": "1"}}},
+		},
+		{
+			name: "whole array element is kept",
+			doc:  bson.M{"contacts": bson.A{"a", "b"}},
+			path: "contacts.0",
+			want: bson.M{"contacts": bson.A{"a", "b"}},
+		},
+		{
+			name: "missing field",
+			doc:  bson.M{"name": "A"},
+			path: "email",
+			want: bson.M{"name": "A"},
+		},
+		{
+			name: "missing intermediate",
+			doc:  bson.D{{Key: "name", Value: "A"}},
+			path: "profile.ssn",
+			want: bson.D{{Key: "name", Value: "A"}},
+		},
+		{
+			name: "non-document intermediate",
+			doc:  bson.M{"profile": "hidden", "tags": bson.A{"x", 2}},
+			path: "profile.ssn",
+			want: bson.M{"profile": "hidden", "tags": bson.A{"x", 2}},
+		},
+		{
+			name: "scalars inside an array",
+			doc:  bson.M{"tags": bson.A{"x", 2}},
+			path: "tags.label",
+			want: bson.M{"tags": bson.A{"x", 2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, err := parseRedactPaths(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, n := redactPath(tt.doc, paths[0])
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redactPath(%s) = %v, want %v", tt.path, got, tt.want)
+			}
+			if n != tt.n {
+				t.Errorf("redactPath(%s) removed %d fields, want %d", tt.path, n, tt.n)
+			}
+		})
+	}
+}
+
+func TestParseRedactPaths(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    [][]string
+		wantErr bool
+	}{
+		{in: "email", want: [][]string{{"email"}}},
+		{in: "email, profile.ssn", want: [][]string{{"email"}, {"profile", "ssn"}}},
+		{in: "contacts.0.phone", want: [][]string{{"contacts", "0", "phone"}}},
+		{in: "_id.secret", want: [][]string{{"_id", "secret"}}},
+		{in: "_id", wantErr: true},
+		{in: "email,_id", wantErr: true},
+		{in: "profile..ssn", wantErr: true},
+		{in: ".email", wantErr: true},
+		{in: "email.", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseRedactPaths(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseRedactPaths(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRedactPaths(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRedactPaths(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
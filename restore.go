@@ -0,0 +1,881 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// restoreCmd loads a backup written by backupCmd back into MongoDB: a
+// directory of <db>.<coll>.jsonl files or a single merged file, whose
+// documents are routed by their _meta field.
+func restoreCmd(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	input := fs.String("input", "", "Backup directory or merged .jsonl/.json file, optionally .gz (required)")
+	dbOverride := fs.String("db", "", "Restore into this database (default: the database the backup was taken from)")
+	uriEnv := fs.String("uri-env", "", "Read the MongoDB URI from this environment variable")
+	profile := fs.String("profile", "", "Saved connection profile to use (default: the default profile)")
+	exclude := fs.String("exclude", "", "Comma-separated collection names to skip")
+	batchSize := fs.Int("batch", 1000, "Documents per InsertMany (restore reads files: there is no cursor batch to share it with)")
+	drop := fs.Bool("drop", false, "Drop each target collection before restoring into it")
+	onDuplicate := fs.String("on-duplicate-key", "stop", "When a document's _id already exists: stop, skip (keep the existing one) or replace it")
+	ordered := fs.Bool("ordered", true, "Stop at the first failed document; false attempts every document and reports each failure")
+	collPrefix := fs.String("collection-prefix", "", "Prepend this to every target collection name, e.g. restored_")
+	collSuffix := fs.String("collection-suffix", "", "Append this to every target collection name, e.g. _bak")
+	mergeKey := fs.String("merge-key", "_meta", "Field of a merged file's documents naming their db and collection (removed before the insert)")
+	restoreOrder := fs.String("restore-order", "", "File listing collection names, one per line, to restore first and in that order (directory backups)")
+	parallel := fs.Int("parallel", 1, "Number of collections restored concurrently, each from its own files (directory backups)")
+	noIndexes := fs.Bool("no-indexes", false, "Do not recreate the indexes saved with the backup")
+	deferIndexes := fs.Bool("defer-indexes", false, "Load every collection first, then recreate the saved indexes (--parallel at a time)")
+	dryRun := fs.Bool("dry-run", false, "Print the collections, document counts and target namespaces without writing anything")
+	validateOnly := fs.Bool("validate-only", false, "Read and decode every file and check each document's _id, without connecting or writing")
+	strict := fs.Bool("strict", false, "Accept canonical Extended JSON only (a --canonical backup), rejecting bare numbers and other relaxed forms")
+	retryWrites := fs.Bool("retry-writes", true, "Use retryable writes (disable for servers that do not support them)")
+	timeout := fs.Duration("timeout", 0, "Operation timeout (0 = no timeout)")
+	_ = fs.Parse(args)
+
+	if *input == "" {
+		fatal(errors.New("restore needs --input"))
+	}
+	if *batchSize <= 0 {
+		fatal(fmt.Errorf("invalid --batch %d", *batchSize))
+	}
+	switch *onDuplicate {
+	case "stop", "skip", "replace":
+	default:
+		fatal(fmt.Errorf("invalid --on-duplicate-key %q (want stop, skip or replace)", *onDuplicate))
+	}
+	if *onDuplicate == "skip" {
+		if flagWasSet(fs, "ordered") && *ordered {
+			fatal(errors.New("--on-duplicate-key skip inserts unordered; it cannot be combined with --ordered=true"))
+		}
+		*ordered = false
+	}
+	if *deferIndexes && *noIndexes {
+		fatal(errors.New("--defer-indexes and --no-indexes cannot be combined"))
+	}
+	if *dryRun && *validateOnly {
+		fatal(errors.New("--dry-run and --validate-only cannot be combined"))
+	}
+	if *parallel < 1 {
+		fatal(fmt.Errorf("invalid --parallel %d", *parallel))
+	}
+	st, err := os.Stat(*input)
+	if err != nil {
+		fatal(err)
+	}
+	if *parallel > 1 && !st.IsDir() {
+		fatal(errors.New("--parallel needs a backup directory (a merged file is read in one pass)"))
+	}
+	if err := expandPathFlags(restoreOrder); err != nil {
+		fatal(err)
+	}
+	if *mergeKey == "" {
+		fatal(errors.New("--merge-key cannot be empty"))
+	}
+	if flagWasSet(fs, "merge-key") && st.IsDir() {
+		fatal(errors.New("--merge-key applies to a merged file; a backup directory is routed by file name"))
+	}
+	if *restoreOrder != "" && !st.IsDir() {
+		fatal(errors.New("--restore-order needs a backup directory (a merged file is restored in file order)"))
+	}
+
+	r := &restoreRun{
+		targetDB:    *dbOverride,
+		batchSize:   *batchSize,
+		drop:        *drop,
+		onDuplicate: *onDuplicate,
+		ordered:     *ordered,
+		collPrefix:  *collPrefix,
+		collSuffix:  *collSuffix,
+		mergeKey:    *mergeKey,
+		noIndexes:   *noIndexes,
+		deferIdx:    *deferIndexes,
+		strict:      *strict,
+		exclude:     map[string]bool{},
+		prepared:    map[string]bool{},
+		existing:    map[string]map[string]bool{},
+	}
+	for _, n := range splitCSV(*exclude) {
+		r.exclude[n] = true
+	}
+	if *restoreOrder != "" {
+		if r.order, err = readRestoreOrder(*restoreOrder); err != nil {
+			fatal(err)
+		}
+	}
+
+	isDir := st.IsDir()
+	r.indexDir = *input
+	if !isDir {
+		r.indexDir = filepath.Dir(*input)
+	}
+	if m, err := readManifest(manifestPath(*input, isDir)); err == nil {
+		r.manifest = &m
+	} else if !errors.Is(err, os.ErrNotExist) {
+		fatal(err)
+	}
+	if *strict && r.manifest != nil && !r.manifest.Canonical {
+		fatal(errors.New("--strict needs a backup written with --canonical (the manifest says it is relaxed Extended JSON)"))
+	}
+	if *validateOnly {
+		// Files only: no configuration or server is needed.
+		if err := r.validate(*input, isDir); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	cfg, err := resolveConfig(*profile, *uriEnv, *dbOverride)
+	if err != nil {
+		fatal(err)
+	}
+	connURI, err := cfg.connectURI()
+	if err != nil {
+		fatal(err)
+	}
+
+	sigCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if *timeout > 0 {
+		ctx, cancel = context.WithTimeout(sigCtx, *timeout)
+	} else {
+		ctx, cancel = context.WithCancel(sigCtx)
+	}
+	defer cancel()
+
+	clientOpts := clientOptions(connURI)
+	if flagWasSet(fs, "retry-writes") || clientOpts.RetryWrites == nil {
+		clientOpts.SetRetryWrites(*retryWrites)
+	}
+	if r.client, err = mongo.Connect(ctx, clientOpts); err != nil {
+		fatal(err)
+	}
+	defer func() { _ = r.client.Disconnect(context.Background()) }()
+
+	switch {
+	case *dryRun:
+		if err := r.dryRun(ctx, *input, isDir); err != nil {
+			fatal(err)
+		}
+		return
+	case isDir:
+		err = r.restoreDir(ctx, *input, *parallel)
+	default:
+		err = r.restoreMerged(ctx, *input)
+	}
+	if err == nil && len(r.deferred) > 0 {
+		err = r.buildDeferred(ctx, *parallel)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	if r.failed > 0 {
+		fatal(fmt.Errorf("%d documents failed to restore (listed above)", r.failed))
+	}
+	fmt.Printf("Restore complete: %d documents in %d collections.\n", r.restored, r.collections)
+}
+
+// restoreRun holds the state shared by the collections of one restore.
+type restoreRun struct {
+	client      *mongo.Client
+	targetDB    string // --db; "" = the backup's own database
+	batchSize   int
+	drop        bool
+	onDuplicate string // --on-duplicate-key: stop, skip or replace
+	ordered     bool   // --ordered
+	collPrefix  string // --collection-prefix
+	collSuffix  string // --collection-suffix
+	mergeKey    string // --merge-key: routing field of merged documents
+	collections int    // collections restored
+	restored    int64  // documents written, over all collections
+	failed      int64  // documents rejected with --ordered=false
+	noIndexes   bool   // --no-indexes: leave the saved index specs unused
+	deferIdx    bool   // --defer-indexes: build them after all the data
+	strict      bool   // --strict: canonical Extended JSON only
+	exclude     map[string]bool
+	order       []string  // --restore-order: collections restored first
+	manifest    *Manifest // nil when the backup has none
+	indexDir    string    // directory holding the <db>.<coll>.indexes.json files
+
+	mu       sync.Mutex                 // guards prepared, deferred and existing for --parallel workers
+	prepared map[string]bool            // "<db>.<coll>" already dropped/created
+	deferred []indexJob                 // index builds queued by --defer-indexes
+	existing map[string]map[string]bool // collection names per target database
+}
+
+// restoreFile is one collection of a directory backup and its files, none
+// for a split collection without documents (it is still created).
+type restoreFile struct {
+	db, coll string
+	files    []string
+}
+
+// dirSources lists the collections of a directory backup and their files.
+// The manifest lists the files (including --output-split-by-date
+// partitions); without one the <db>.<coll>.jsonl names are parsed, assuming
+// percent name encoding.
+func (r *restoreRun) dirSources(dir string) ([]restoreFile, error) {
+	var sources []restoreFile
+	if r.manifest != nil {
+		for _, c := range r.manifest.Collections {
+			src := restoreFile{db: r.manifest.DB, coll: c.Name}
+			for _, f := range c.dataFiles() {
+				src.files = append(src.files, filepath.Join(dir, f))
+			}
+			sources = append(sources, src)
+		}
+	} else {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+		if err != nil {
+			return nil, err
+		}
+		gzipped, err := filepath.Glob(filepath.Join(dir, "*.jsonl.gz"))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, gzipped...)
+		sort.Strings(paths)
+		seen := map[string]int{} // db.coll -> index in sources, joining partitions
+		for _, p := range paths {
+			db, coll, ok := splitCollFileName(filepath.Base(p))
+			if !ok {
+				fmt.Fprintf(os.Stderr, "Warning: skipping %s: not a <db>.<collection>.jsonl file\n", p)
+				continue
+			}
+			if i, ok := seen[db+"."+coll]; ok {
+				sources[i].files = append(sources[i].files, p)
+				continue
+			}
+			seen[db+"."+coll] = len(sources)
+			sources = append(sources, restoreFile{db: db, coll: coll, files: []string{p}})
+		}
+		if len(sources) == 0 {
+			return nil, fmt.Errorf("no manifest and no .jsonl files in %s", dir)
+		}
+	}
+	if r.order != nil {
+		for _, name := range orderSources(sources, r.order) {
+			fmt.Fprintf(os.Stderr, "Warning: --restore-order names %s, which is not in the backup\n", name)
+		}
+	}
+	return sources, nil
+}
+
+// readRestoreOrder reads a --restore-order file: one collection name per
+// line. Blank lines and lines starting with # are ignored.
+func readRestoreOrder(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("restore order: %w", err)
+	}
+	var order []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		order = append(order, line)
+	}
+	if len(order) == 0 {
+		return nil, fmt.Errorf("restore order %s lists no collections", path)
+	}
+	return order, nil
+}
+
+// orderSources sorts sources into the order of the names in order; the
+// collections it does not list follow in backup order. It returns the names
+// that match no collection.
+func orderSources(sources []restoreFile, order []string) []string {
+	pos := make(map[string]int, len(order))
+	for i, name := range order {
+		if _, ok := pos[name]; !ok {
+			pos[name] = i
+		}
+	}
+	rank := func(src restoreFile) int {
+		if i, ok := pos[src.coll]; ok {
+			return i
+		}
+		return len(order)
+	}
+	sort.SliceStable(sources, func(i, j int) bool { return rank(sources[i]) < rank(sources[j]) })
+
+	found := map[string]bool{}
+	for _, src := range sources {
+		found[src.coll] = true
+	}
+	var unknown []string
+	for _, name := range order {
+		if !found[name] {
+			unknown = append(unknown, name)
+			found[name] = true // warn once
+		}
+	}
+	return unknown
+}
+
+// restoreDir restores every collection of a directory backup, n at a time
+// with --parallel.
+func (r *restoreRun) restoreDir(ctx context.Context, dir string, n int) error {
+	sources, err := r.dirSources(dir)
+	if err != nil {
+		return err
+	}
+	var todo []restoreFile
+	for _, src := range sources {
+		if r.exclude[src.coll] {
+			fmt.Printf("Skipping collection: %s\n", src.coll)
+			continue
+		}
+		todo = append(todo, src)
+	}
+	finished := func(b *restoreBatch, err error) error {
+		if err != nil {
+			return err
+		}
+		r.done(b)
+		return nil
+	}
+	if n > 1 {
+		return r.restoreParallel(ctx, todo, n, finished)
+	}
+	for _, src := range todo {
+		if err := finished(r.restoreSource(ctx, src)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreSource loads the files of one collection of a directory backup and
+// recreates its indexes. It is run by the --parallel workers.
+func (r *restoreRun) restoreSource(ctx context.Context, src restoreFile) (*restoreBatch, error) {
+	coll, err := r.target(ctx, src.db, src.coll)
+	if err != nil {
+		return nil, err
+	}
+	b := r.newBatch(coll, src.coll)
+	for _, path := range src.files {
+		fmt.Printf("Restoring %s <- %s\n", coll.Name(), path)
+		err := readBackupFile(path, r.strict, func(doc bson.D) error {
+			return b.add(ctx, doc)
+		})
+		if err != nil {
+			return nil, b.fail(err)
+		}
+	}
+	if err := b.flush(ctx); err != nil {
+		return nil, b.fail(err)
+	}
+	var dataFile string
+	if len(src.files) > 0 {
+		dataFile = src.files[0]
+	}
+	if path := r.indexFile(src.coll, dataFile); path != "" {
+		if err := r.createIndexes(ctx, coll, path); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// done adds a finished collection to the run's totals and reports it.
+func (r *restoreRun) done(b *restoreBatch) {
+	r.collections++
+	r.restored += b.n
+	r.failed += b.failed
+	fmt.Printf("Done %s (%s)\n", b.coll.Name(), b.summary())
+}
+
+// restoreMerged restores a merged backup file, sending each document to the
+// collection named by its _meta field (--merge-key), which is removed before
+// the insert.
+func (r *restoreRun) restoreMerged(ctx context.Context, path string) error {
+	batches := map[string]*restoreBatch{}
+	var order []string
+	skipped := map[string]bool{}
+
+	fmt.Printf("Restoring from merged file: %s\n", path)
+	n := 0
+	err := readBackupFile(path, r.strict, func(doc bson.D) error {
+		n++
+		doc, db, collName, err := takeMeta(doc, r.mergeKey)
+		if err != nil {
+			return fmt.Errorf("%s: document %d: %w", path, n, err)
+		}
+		if r.exclude[collName] {
+			if !skipped[collName] {
+				skipped[collName] = true
+				fmt.Printf("Skipping collection: %s\n", collName)
+			}
+			return nil
+		}
+		key := db + "." + collName
+		b, ok := batches[key]
+		if !ok {
+			coll, err := r.target(ctx, db, collName)
+			if err != nil {
+				return err
+			}
+			b = r.newBatch(coll, collName)
+			batches[key] = b
+			order = append(order, key)
+		}
+		if err := b.add(ctx, doc); err != nil {
+			return b.fail(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range order {
+		b := batches[key]
+		if err := b.flush(ctx); err != nil {
+			return b.fail(err)
+		}
+		if path := r.indexFile(b.source, ""); path != "" {
+			if err := r.createIndexes(ctx, b.coll, path); err != nil {
+				return err
+			}
+		}
+		r.done(b)
+	}
+	return nil
+}
+
+// targetNS returns the database and collection that collName of database db
+// in the backup is restored into: --db, and --collection-prefix and
+// --collection-suffix around the name.
+func (r *restoreRun) targetNS(db, collName string) (string, string, error) {
+	if r.targetDB != "" {
+		db = r.targetDB
+	}
+	if db == "" {
+		return "", "", fmt.Errorf("%s: the backup does not name a database (use --db)", collName)
+	}
+	name := r.targetName(collName)
+	if err := checkCollectionName(db, name); err != nil {
+		return "", "", fmt.Errorf("%s: %w", collName, err)
+	}
+	return db, name, nil
+}
+
+func (r *restoreRun) targetName(collName string) string {
+	return r.collPrefix + collName + r.collSuffix
+}
+
+// checkCollectionName rejects a collection name MongoDB would refuse: one
+// with '$' or NUL, a "system." name, or a namespace over 255 bytes.
+func checkCollectionName(db, name string) error {
+	switch {
+	case name == "":
+		return errors.New("empty collection name")
+	case strings.ContainsAny(name, "$\x00"):
+		return fmt.Errorf("invalid collection name %q (contains '$' or NUL)", name)
+	case strings.HasPrefix(name, "system."):
+		return fmt.Errorf("invalid collection name %q (the system. prefix is reserved)", name)
+	case len(db)+1+len(name) > 255:
+		return fmt.Errorf("namespace %s.%s is longer than 255 bytes", db, name)
+	}
+	return nil
+}
+
+// collectionNames returns the collections of a target database, listed once
+// per run.
+func (r *restoreRun) collectionNames(ctx context.Context, db string) (map[string]bool, error) {
+	if exists, ok := r.existing[db]; ok {
+		return exists, nil
+	}
+	names, err := r.client.Database(db).ListCollectionNames(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	exists := map[string]bool{}
+	for _, n := range names {
+		exists[n] = true
+	}
+	r.existing[db] = exists
+	return exists, nil
+}
+
+// target returns the collection to restore collName into, dropping and
+// (re)creating it on first use as --drop and the manifest require.
+func (r *restoreRun) target(ctx context.Context, db, source string) (*mongo.Collection, error) {
+	db, collName, err := r.targetNS(db, source)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := r.client.Database(db)
+	key := db + "." + collName
+	if r.prepared[key] {
+		return d.Collection(collName), nil
+	}
+	r.prepared[key] = true
+
+	exists, err := r.collectionNames(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if r.drop && exists[collName] {
+		if err := d.Collection(collName).Drop(ctx); err != nil {
+			return nil, fmt.Errorf("drop %s: %w", key, err)
+		}
+		exists[collName] = false
+	}
+	entry := r.manifestEntry(source)
+	if entry.NumbersStringified > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %s was backed up with --numbers-as-strings; %d values are restored as strings\n", collName, entry.NumbersStringified)
+	}
+	if !exists[collName] {
+		// Created up front so empty collections come back too.
+		if err := createFromManifest(ctx, d, collName, entry, r.targetName); err != nil {
+			return nil, fmt.Errorf("create %s: %w", key, err)
+		}
+		exists[collName] = true
+	}
+	return d.Collection(collName), nil
+}
+
+// manifestEntry returns the manifest entry of collName, or an entry with
+// only the name when the backup has no manifest or does not list it.
+func (r *restoreRun) manifestEntry(collName string) CollectionManifest {
+	if r.manifest != nil {
+		for _, c := range r.manifest.Collections {
+			if c.Name == collName {
+				return c
+			}
+		}
+	}
+	return CollectionManifest{Name: collName}
+}
+
+// createFromManifest creates collection name with the options and validator
+// recorded in manifest entry c (capped size, collation, time-series spec,
+// ...). The source of a view is renamed with rename, like the view itself.
+func createFromManifest(ctx context.Context, db *mongo.Database, name string, c CollectionManifest, rename func(string) string) error {
+	cmd := bson.D{{Key: "create", Value: name}}
+	if len(c.Options) > 0 {
+		var opts bson.D
+		if err := bson.UnmarshalExtJSON(c.Options, false, &opts); err != nil {
+			return fmt.Errorf("options: %w", err)
+		}
+		for i, e := range opts {
+			if on, ok := e.Value.(string); ok && e.Key == "viewOn" {
+				opts[i].Value = rename(on)
+			}
+		}
+		cmd = append(cmd, opts...)
+	}
+	if v := c.Validator; v != nil {
+		var validator bson.D
+		if err := bson.UnmarshalExtJSON(v.Validator, false, &validator); err != nil {
+			return fmt.Errorf("validator: %w", err)
+		}
+		cmd = append(cmd, bson.E{Key: "validator", Value: validator})
+		if v.Level != "" {
+			cmd = append(cmd, bson.E{Key: "validationLevel", Value: v.Level})
+		}
+		if v.Action != "" {
+			cmd = append(cmd, bson.E{Key: "validationAction", Value: v.Action})
+		}
+	}
+	return db.RunCommand(ctx, cmd).Err()
+}
+
+// restoreBatch buffers documents for one target collection and writes them,
+// size at a time: with InsertMany, or as upserts by _id under
+// --on-duplicate-key replace.
+type restoreBatch struct {
+	coll     *mongo.Collection
+	source   string // collection name in the backup
+	size     int
+	dup      string // --on-duplicate-key: stop, skip or replace
+	ordered  bool   // --ordered: stop at the first failed document
+	docs     []interface{}
+	read     int64 // documents added, for reporting failed ones by position
+	n        int64 // documents inserted
+	skipped  int64 // duplicates left as they were (skip)
+	replaced int64 // existing documents overwritten (replace)
+	failed   int64 // documents rejected by an unordered batch
+}
+
+func (r *restoreRun) newBatch(coll *mongo.Collection, source string) *restoreBatch {
+	return &restoreBatch{coll: coll, source: source, size: r.batchSize, dup: r.onDuplicate, ordered: r.ordered}
+}
+
+func (b *restoreBatch) add(ctx context.Context, doc bson.D) error {
+	b.docs = append(b.docs, doc)
+	b.read++
+	if len(b.docs) < b.size {
+		return nil
+	}
+	return b.flush(ctx)
+}
+
+func (b *restoreBatch) flush(ctx context.Context) error {
+	if len(b.docs) == 0 {
+		return nil
+	}
+	defer func() { b.docs = b.docs[:0] }()
+	if b.dup == "replace" {
+		return b.upsert(ctx)
+	}
+	_, err := b.coll.InsertMany(ctx, b.docs, options.InsertMany().SetOrdered(b.ordered))
+	if err == nil {
+		b.n += int64(len(b.docs))
+		return nil
+	}
+	var bwe mongo.BulkWriteException
+	if !errors.As(err, &bwe) || len(bwe.WriteErrors) == 0 {
+		return err
+	}
+	if b.ordered {
+		// Everything before the first failure went in.
+		b.n += int64(bwe.WriteErrors[0].Index)
+		return err
+	}
+	b.n += int64(len(b.docs) - len(bwe.WriteErrors))
+	return b.writeErrors(bwe)
+}
+
+// upsert writes the batch as replace-one-by-_id upserts, so documents that
+// already exist are overwritten and the others inserted.
+func (b *restoreBatch) upsert(ctx context.Context) error {
+	models := make([]mongo.WriteModel, len(b.docs))
+	for i, d := range b.docs {
+		doc := d.(bson.D)
+		if id, ok := docID(doc); ok {
+			models[i] = mongo.NewReplaceOneModel().SetFilter(bson.D{{Key: "_id", Value: id}}).SetReplacement(doc).SetUpsert(true)
+		} else {
+			models[i] = mongo.NewInsertOneModel().SetDocument(doc)
+		}
+	}
+	res, err := b.coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(b.ordered))
+	if res != nil {
+		b.n += res.InsertedCount + res.UpsertedCount
+		b.replaced += res.MatchedCount
+	}
+	var bwe mongo.BulkWriteException
+	if err == nil || b.ordered || !errors.As(err, &bwe) || len(bwe.WriteErrors) == 0 {
+		return err
+	}
+	return b.writeErrors(bwe)
+}
+
+// writeErrors handles the failures of an unordered batch: duplicates are
+// counted under --on-duplicate-key skip, every other failed document is
+// reported with its position in the collection's files and its _id, and the
+// restore goes on. Only a write concern error ends it.
+func (b *restoreBatch) writeErrors(bwe mongo.BulkWriteException) error {
+	base := b.read - int64(len(b.docs))
+	for _, we := range bwe.WriteErrors {
+		if b.dup == "skip" && isDuplicateKey(we.WriteError) {
+			b.skipped++
+			continue
+		}
+		b.failed++
+		id, _ := docID(b.docs[we.Index].(bson.D))
+		fmt.Fprintf(os.Stderr, "Failed %s document %d (_id %v): %s\n", b.coll.Name(), base+int64(we.Index)+1, id, we.Message)
+	}
+	if bwe.WriteConcernError != nil {
+		return bwe
+	}
+	return nil
+}
+
+// summary describes what the batch wrote, for the "Done" line.
+func (b *restoreBatch) summary() string {
+	s := fmt.Sprintf("%d docs", b.n)
+	if b.skipped > 0 {
+		s += fmt.Sprintf(", %d duplicates skipped", b.skipped)
+	}
+	if b.replaced > 0 {
+		s += fmt.Sprintf(", %d replaced", b.replaced)
+	}
+	if b.failed > 0 {
+		s += fmt.Sprintf(", %d failed", b.failed)
+	}
+	return s
+}
+
+// fail wraps an insert error with the collection and the progress so far.
+func (b *restoreBatch) fail(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("restore %s: %d docs restored, then a duplicate key: the target already holds data (use --drop to replace it, or --on-duplicate-key skip|replace)", b.coll.Name(), b.n)
+	}
+	return fmt.Errorf("restore %s: %w (%d docs restored)", b.coll.Name(), err, b.n)
+}
+
+// isDuplicateKey reports whether a write failed on a unique index (E11000
+// and its legacy variants).
+func isDuplicateKey(we mongo.WriteError) bool {
+	return we.Code == 11000 || we.Code == 11001 || we.Code == 12582
+}
+
+// docID returns the _id of doc.
+func docID(doc bson.D) (interface{}, bool) {
+	for _, e := range doc {
+		if e.Key == "_id" {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// readBackupFile decodes every document of a backup file and passes it to
+// fn: one Extended JSON document per line, or a JSON array for .json files.
+// A .gz suffix is decompressed first. With strict, documents must be
+// canonical Extended JSON (see checkCanonical).
+func readBackupFile(path string, strict bool, fn func(bson.D) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var in io.Reader = f
+	name := path
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(bufio.NewReaderSize(f, 1<<20))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		defer zr.Close()
+		in = zr
+		name = strings.TrimSuffix(path, ".gz")
+	}
+	br := bufio.NewReaderSize(in, 1<<20)
+
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		dec := json.NewDecoder(br)
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return fmt.Errorf("%s: not a JSON array", path)
+		}
+		for n := 1; dec.More(); n++ {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return fmt.Errorf("%s: document %d: %w", path, n, err)
+			}
+			var doc bson.D
+			if err := decodeExtJSON(raw, strict, &doc); err != nil {
+				return fmt.Errorf("%s: document %d: %w", path, n, err)
+			}
+			if err := fn(doc); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Lines are read whole: documents can be far longer than a
+	// bufio.Scanner token.
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var doc bson.D
+			if uerr := decodeExtJSON(line, strict, &doc); uerr != nil {
+				return fmt.Errorf("%s:%d: %w", path, n, uerr)
+			}
+			if ferr := fn(doc); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// decodeExtJSON parses one backup document, as relaxed Extended JSON or, with
+// strict, as canonical Extended JSON only.
+func decodeExtJSON(data []byte, strict bool, doc *bson.D) error {
+	if strict {
+		if err := checkCanonical(data); err != nil {
+			return err
+		}
+	}
+	return bson.UnmarshalExtJSON(data, strict, doc)
+}
+
+// takeMeta removes the routing field key (_meta, or restore --merge-key)
+// a merged backup adds to every document and returns the database and
+// collection it names.
+func takeMeta(doc bson.D, key string) (bson.D, string, string, error) {
+	for i, e := range doc {
+		if e.Key != key {
+			continue
+		}
+		meta, ok := e.Value.(bson.D)
+		if !ok {
+			return doc, "", "", fmt.Errorf("merged backup: %s is not a document", key)
+		}
+		var db, coll string
+		for _, m := range meta {
+			switch m.Key {
+			case "db":
+				db, _ = m.Value.(string)
+			case "collection":
+				coll, _ = m.Value.(string)
+			}
+		}
+		if coll == "" {
+			return doc, "", "", fmt.Errorf("merged backup: %s has no collection", key)
+		}
+		return append(doc[:i:i], doc[i+1:]...), db, coll, nil
+	}
+	return doc, "", "", fmt.Errorf("merged backup: document without %s (was the file written in directory mode?)", key)
+}
+
+// splitCollFileName parses "<db>.<collection>.jsonl[.gz]" as written with
+// the default percent name encoding, or a "<db>.<collection>.<bucket>.jsonl"
+// partition of --output-split-by-date. Database names cannot contain '.', so
+// the first dot separates the two.
+func splitCollFileName(name string) (db, coll string, ok bool) {
+	base := trimBucket(strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".jsonl"))
+	i := strings.IndexByte(base, '.')
+	if i <= 0 || i == len(base)-1 {
+		return "", "", false
+	}
+	coll, err := url.PathUnescape(base[i+1:])
+	if err != nil {
+		return "", "", false
+	}
+	return base[:i], coll, true
+}
+
+// trimBucket removes a partition's bucket from a file name stem:
+// "<db>.<coll>.2024-01" becomes "<db>.<coll>". A percent-encoded collection
+// name has no '.' of its own, so a dotted suffix after it is a bucket.
+func trimBucket(stem string) string {
+	i := strings.LastIndexByte(stem, '.')
+	if i <= strings.IndexByte(stem, '.') || !isBucketName(stem[i+1:]) {
+		return stem
+	}
+	return stem[:i]
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestSplitCollFileName(t *testing.T) {
+	tests := []struct {
+		name     string
+		db, coll string
+		ok       bool
+	}{
+		{"shop.orders.jsonl", "shop", "orders", true},
+		{"shop.orders.jsonl.gz", "shop", "orders", true},
+		{"shop.a%2Eb.jsonl", "shop", "a.b", true},
+		{"shop.orders.2024.jsonl", "shop", "orders", true},
+		{"shop.orders.2024-01.jsonl.gz", "shop", "orders", true},
+		{"shop.orders.2024-01-31.jsonl", "shop", "orders", true},
+		{"shop.orders.undated.jsonl", "shop", "orders", true},
+		{"shop.a%2Eb.2024-01.jsonl", "shop", "a.b", true},
+		{"shop.2024-01.jsonl", "shop", "2024-01", true},
+		{"shop.orders.v2.jsonl", "shop", "orders.v2", true},
+		{"shop.jsonl", "", "", false},
+		{".orders.jsonl", "", "", false},
+		{"shop.bad%zz.jsonl", "", "", false},
+	}
+	for _, tt := range tests {
+		db, coll, ok := splitCollFileName(tt.name)
+		if db != tt.db || coll != tt.coll || ok != tt.ok {
+			t.Errorf("splitCollFileName(%q) = %q, %q, %v; want %q, %q, %v", tt.name, db, coll, ok, tt.db, tt.coll, tt.ok)
+		}
+	}
+}
+
+func TestRestoreBatchWriteErrors(t *testing.T) {
+	// Connect does not dial; the batch only needs a collection name.
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	coll := client.Database("shop").Collection("orders")
+
+	bwe := mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+		{WriteError: mongo.WriteError{Index: 0, Code: 11000, Message: "E11000 duplicate key"}},
+		{WriteError: mongo.WriteError{Index: 2, Code: 121, Message: "Document failed validation"}},
+	}}
+	for _, tt := range []struct {
+		dup             string
+		skipped, failed int64
+	}{
+		{"skip", 1, 1},
+		{"stop", 0, 2},
+	} {
+		b := &restoreBatch{coll: coll, dup: tt.dup, read: 3}
+		for i := 1; i <= 3; i++ {
+			b.docs = append(b.docs, bson.D{{Key: "_id", Value: i}})
+		}
+		if err := b.writeErrors(bwe); err != nil {
+			t.Errorf("%s: writeErrors: %v", tt.dup, err)
+		}
+		if b.skipped != tt.skipped || b.failed != tt.failed {
+			t.Errorf("%s: skipped %d, failed %d; want %d, %d", tt.dup, b.skipped, b.failed, tt.skipped, tt.failed)
+		}
+	}
+
+	bwe.WriteConcernError = &mongo.WriteConcernError{Code: 64, Message: "waiting for replication timed out"}
+	b := &restoreBatch{coll: coll, dup: "skip", docs: []interface{}{bson.D{}, bson.D{}, bson.D{}}, read: 3}
+	if err := b.writeErrors(bwe); err == nil {
+		t.Error("writeErrors ignored a write concern error")
+	}
+}
+
+func TestTargetNS(t *testing.T) {
+	r := &restoreRun{collPrefix: "restored_", collSuffix: "_bak"}
+	db, coll, err := r.targetNS("shop", "orders")
+	if err != nil || db != "shop" || coll != "restored_orders_bak" {
+		t.Errorf("targetNS = %q, %q, %v; want shop, restored_orders_bak", db, coll, err)
+	}
+	r.targetDB = "staging"
+	if db, _, _ := r.targetNS("shop", "orders"); db != "staging" {
+		t.Errorf("targetNS with --db staging: db = %q", db)
+	}
+	for _, bad := range []*restoreRun{
+		{collPrefix: "system."},
+		{collSuffix: "$x"},
+		{collSuffix: "\x00"},
+		{collSuffix: strings.Repeat("x", 250)},
+	} {
+		if _, coll, err := bad.targetNS("shop", "orders"); err == nil {
+			t.Errorf("targetNS accepted %q", coll)
+		}
+	}
+	if _, _, err := (&restoreRun{}).targetNS("", "orders"); err == nil {
+		t.Error("targetNS accepted a collection without a database")
+	}
+}
+
+func TestOrderSources(t *testing.T) {
+	var sources []restoreFile
+	for _, c := range []string{"a", "b", "c", "d", "e"} {
+		sources = append(sources, restoreFile{db: "shop", coll: c})
+	}
+	unknown := orderSources(sources, []string{"d", "missing", "b", "d"})
+	var got []string
+	for _, src := range sources {
+		got = append(got, src.coll)
+	}
+	if want := "d b a c e"; strings.Join(got, " ") != want {
+		t.Errorf("order = %v, want %s", got, want)
+	}
+	if len(unknown) != 1 || unknown[0] != "missing" {
+		t.Errorf("unknown = %v, want [missing]", unknown)
+	}
+}
+
+func TestTakeMeta(t *testing.T) {
+	doc := bson.D{{Key: "_id", Value: 1}, {Key: "_ns", Value: bson.D{{Key: "db", Value: "shop"}, {Key: "collection", Value: "orders"}}}, {Key: "x", Value: 2}}
+	rest, db, coll, err := takeMeta(doc, "_ns")
+	if err != nil || db != "shop" || coll != "orders" || len(rest) != 2 || rest[1].Key != "x" {
+		t.Errorf("takeMeta(_ns) = %v, %q, %q, %v", rest, db, coll, err)
+	}
+	_, _, _, err = takeMeta(bson.D{{Key: "_id", Value: 1}}, "_ns")
+	if err == nil || !strings.Contains(err.Error(), "without _ns") {
+		t.Errorf("takeMeta without the key: %v", err)
+	}
+	_, _, _, err = takeMeta(bson.D{{Key: "_ns", Value: "shop.orders"}}, "_ns")
+	if err == nil || !strings.Contains(err.Error(), "_ns is not a document") {
+		t.Errorf("takeMeta with a string key: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// planEntry is one collection of a restore --dry-run or --validate-only.
+type planEntry struct {
+	srcDB, source string // namespace in the backup
+	db, coll      string // target namespace (--dry-run)
+	files         int
+	docs          int64
+	indexes       bool // saved index specs would be recreated
+}
+
+// scan reads every file of the backup at input and counts the documents of
+// each collection not excluded. check, when set, is called on every
+// document; its error is reported with the file and document number.
+func (r *restoreRun) scan(input string, isDir bool, check func(bson.D) error) ([]*planEntry, error) {
+	read := func(e *planEntry, path string, doc bson.D, n int) error {
+		if check != nil {
+			if err := check(doc); err != nil {
+				return fmt.Errorf("%s: document %d: %w", path, n, err)
+			}
+		}
+		e.docs++
+		return nil
+	}
+	var plan []*planEntry
+	if isDir {
+		sources, err := r.dirSources(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, src := range sources {
+			if r.exclude[src.coll] {
+				fmt.Printf("Skipping collection: %s\n", src.coll)
+				continue
+			}
+			e := &planEntry{srcDB: src.db, source: src.coll, files: len(src.files)}
+			for _, path := range src.files {
+				n := 0
+				err := readBackupFile(path, r.strict, func(doc bson.D) error {
+					n++
+					return read(e, path, doc, n)
+				})
+				if err != nil {
+					return nil, err
+				}
+			}
+			var dataFile string
+			if len(src.files) > 0 {
+				dataFile = src.files[0]
+			}
+			e.indexes = r.indexFile(src.coll, dataFile) != ""
+			plan = append(plan, e)
+		}
+		return plan, nil
+	}
+
+	byKey := map[string]*planEntry{}
+	skipped := map[string]bool{}
+	n := 0
+	err := readBackupFile(input, r.strict, func(doc bson.D) error {
+		n++
+		doc, db, collName, err := takeMeta(doc, r.mergeKey)
+		if err != nil {
+			return fmt.Errorf("%s: document %d: %w", input, n, err)
+		}
+		if r.exclude[collName] {
+			if !skipped[collName] {
+				skipped[collName] = true
+				fmt.Printf("Skipping collection: %s\n", collName)
+			}
+			return nil
+		}
+		e, ok := byKey[db+"."+collName]
+		if !ok {
+			e = &planEntry{srcDB: db, source: collName, files: 1, indexes: r.indexFile(collName, "") != ""}
+			byKey[db+"."+collName] = e
+			plan = append(plan, e)
+		}
+		return read(e, input, doc, n)
+	})
+	return plan, err
+}
+
+// dryRun prints what restoring input would do: each collection with its
+// target namespace, the documents its files hold, and whether the target
+// exists and how many documents it has. The files are read in full (so a
+// bad line fails the dry run as it would the restore); the server is only
+// asked for collection names and counts.
+func (r *restoreRun) dryRun(ctx context.Context, input string, isDir bool) error {
+	plan, err := r.scan(input, isDir, nil)
+	if err != nil {
+		return err
+	}
+	for _, e := range plan {
+		if e.db, e.coll, err = r.targetNS(e.srcDB, e.source); err != nil {
+			return err
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COLLECTION\tTARGET\tFILES\tDOCS\tINDEXES\tEXISTS\tCURRENT\tACTION")
+	var total int64
+	for _, e := range plan {
+		exists, err := r.collectionNames(ctx, e.db)
+		if err != nil {
+			return err
+		}
+		current, action := "-", "create, insert"
+		if exists[e.coll] {
+			n, err := r.client.Database(e.db).Collection(e.coll).EstimatedDocumentCount(ctx)
+			if err != nil {
+				return fmt.Errorf("count %s.%s: %w", e.db, e.coll, err)
+			}
+			current = strconv.FormatInt(n, 10)
+			switch {
+			case r.drop:
+				action = "drop, create, insert"
+			case r.onDuplicate == "stop":
+				action = "insert"
+			default:
+				action = "insert, " + r.onDuplicate + " duplicates"
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s.%s\t%d\t%d\t%s\t%s\t%s\t%s\n", e.source, e.db, e.coll, e.files, e.docs, yesNo(e.indexes), yesNo(exists[e.coll]), current, action)
+		total += e.docs
+	}
+	_ = tw.Flush()
+	fmt.Printf("Dry run: %d collections, %d documents; nothing was written.\n", len(plan), total)
+	return nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// validate reads and decodes every document of the backup at input without
+// connecting to a server, and checks that each has an _id MongoDB accepts.
+// It stops at the first bad document.
+func (r *restoreRun) validate(input string, isDir bool) error {
+	plan, err := r.scan(input, isDir, checkID)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COLLECTION\tFILES\tDOCS")
+	var total int64
+	for _, e := range plan {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", e.source, e.files, e.docs)
+		total += e.docs
+	}
+	_ = tw.Flush()
+	fmt.Printf("Validation OK: %d collections, %d documents.\n", len(plan), total)
+	return nil
+}
+
+// checkID rejects a document without _id (every backed-up document has one,
+// so it is damaged) or with an _id of a type MongoDB refuses: an array, a
+// regular expression or undefined.
+func checkID(doc bson.D) error {
+	id, ok := docID(doc)
+	if !ok {
+		return errors.New("no _id")
+	}
+	switch id.(type) {
+	case bson.A:
+		return errors.New("an array _id cannot be inserted")
+	case primitive.Regex:
+		return errors.New("a regular expression _id cannot be inserted")
+	case primitive.Undefined:
+		return errors.New("an undefined _id cannot be inserted")
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCheckID(t *testing.T) {
+	tests := []struct {
+		doc bson.D
+		ok  bool
+	}{
+		{bson.D{{Key: "_id", Value: primitive.NewObjectID()}}, true},
+		{bson.D{{Key: "n", Value: 1}, {Key: "_id", Value: "k"}}, true},
+		{bson.D{{Key: "_id", Value: bson.D{{Key: "a", Value: 1}}}}, true},
+		{bson.D{{Key: "n", Value: 1}}, false},
+		{bson.D{{Key: "_id", Value: bson.A{1, 2}}}, false},
+		{bson.D{{Key: "_id", Value: primitive.Regex{Pattern: "^a"}}}, false},
+		{bson.D{{Key: "_id", Value: primitive.Undefined{}}}, false},
+	}
+	for _, tt := range tests {
+		if err := checkID(tt.doc); (err == nil) != tt.ok {
+			t.Errorf("checkID(%v) = %v, want ok %v", tt.doc, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// roundtripDiff parses extJSON back into BSON and compares it with doc. It
+// returns the dotted path of the first field whose type or value changed,
+// or "" when the document survives the round trip. Field order is ignored,
+// since documents are decoded into maps before they are marshaled.
+func roundtripDiff(doc bson.M, extJSON []byte, canonical bool) (string, error) {
+	orig, err := bson.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	var back bson.Raw
+	if err := bson.UnmarshalExtJSON(extJSON, canonical, &back); err != nil {
+		return "", fmt.Errorf("parse Extended JSON: %w", err)
+	}
+	return rawDiff(orig, back, ""), nil
+}
+
+func rawDiff(a, b bson.Raw, prefix string) string {
+	ae, err := a.Elements()
+	if err != nil {
+		return prefix
+	}
+	be, err := b.Elements()
+	if err != nil {
+		return prefix
+	}
+	byKey := make(map[string]bson.RawValue, len(be))
+	for _, e := range be {
+		byKey[e.Key()] = e.Value()
+	}
+	for _, e := range ae {
+		path := e.Key()
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		bv, ok := byKey[e.Key()]
+		if !ok {
+			return path
+		}
+		if d := valueDiff(e.Value(), bv, path); d != "" {
+			return d
+		}
+		delete(byKey, e.Key())
+	}
+	for k := range byKey {
+		if prefix != "" {
+			return prefix + "." + k
+		}
+		return k
+	}
+	return ""
+}
+
+func valueDiff(a, b bson.RawValue, path string) string {
+	if a.Type != b.Type {
+		return path
+	}
+	switch a.Type {
+	case bsontype.EmbeddedDocument:
+		return rawDiff(a.Document(), b.Document(), path)
+	case bsontype.Array:
+		av, _ := a.Array().Values()
+		bv, _ := b.Array().Values()
+		if len(av) != len(bv) {
+			return path
+		}
+		for i := range av {
+			if d := valueDiff(av[i], bv[i], path+"."+strconv.Itoa(i)); d != "" {
+				return d
+			}
+		}
+		return ""
+	}
+	if !bytes.Equal(a.Value, b.Value) {
+		return path
+	}
+	return ""
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+var secretRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// loadSecretsFile reads a .env-style file of KEY=VALUE lines. Blank lines and
+// lines starting with # are ignored, an "export " prefix is allowed and
+// values may be wrapped in single or double quotes.
+func loadSecretsFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("secrets file: %w", err)
+	}
+	defer f.Close()
+
+	if st, err := f.Stat(); err == nil && runtime.GOOS != "windows" && st.Mode().Perm()&0o077 != 0 {
+		fmt.Fprintf(os.Stderr, "Warning: secrets file %s is accessible by other users (mode %04o); run: chmod 600 %s\n",
+			path, st.Mode().Perm(), path)
+	}
+
+	vals := map[string]string{}
+	sc := bufio.NewScanner(f)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		k, v, ok := strings.Cut(line, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("secrets file %s:%d: expected KEY=VALUE", path, lineNo)
+		}
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		vals[k] = v
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("secrets file %s: %w", path, err)
+	}
+	return vals, nil
+}
+
+// expandSecrets replaces ${KEY} tokens in the URI s. The process
+// environment takes precedence over the secrets file; an unknown key is an
+// error. Values substituted into the userinfo (user:password@) are
+// percent-escaped, so a password may contain '@', ':', '/' or '%' as is;
+// elsewhere in the URI they are inserted verbatim.
+func expandSecrets(s string, secrets map[string]string) (string, error) {
+	userinfoEnd := -1 // index of the '@' ending the userinfo, if any
+	if _, rest, ok := strings.Cut(s, "://"); ok {
+		hosts, _, _ := strings.Cut(rest, "/")
+		if at := strings.LastIndex(hosts, "@"); at >= 0 {
+			userinfoEnd = len(s) - len(rest) + at
+		}
+	}
+
+	var b strings.Builder
+	var missing []string
+	last := 0
+	for _, m := range secretRef.FindAllStringSubmatchIndex(s, -1) {
+		b.WriteString(s[last:m[0]])
+		last = m[1]
+		key := s[m[2]:m[3]]
+		v, ok := os.LookupEnv(key)
+		if !ok {
+			v, ok = secrets[key]
+		}
+		if !ok {
+			missing = append(missing, key)
+			b.WriteString(s[m[0]:m[1]])
+			continue
+		}
+		if m[0] < userinfoEnd {
+			v = escapeUserinfo(v)
+		}
+		b.WriteString(v)
+	}
+	b.WriteString(s[last:])
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variable(s) in URI: %s", strings.Join(missing, ", "))
+	}
+	return b.String(), nil
+}
+
+// escapeUserinfo percent-escapes v for the user or password of a URI.
+func escapeUserinfo(v string) string {
+	return strings.TrimPrefix(url.UserPassword("", v).String(), ":")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// collSelector holds the backup's collection selection rules. They are all
+// applied up front by selectCollections, before any output file is created.
+type collSelector struct {
+	include   map[string]bool // --include collection names; nil = all
+	exclude   map[string]bool // --exclude collection names
+	excludeNS map[string]bool // --exclude-ns "db.collection" namespaces
+	minBytes  int64           // --exclude-smaller-than; 0 = off
+	maxBytes  int64           // --exclude-larger-than; 0 = off
+	skipEmpty bool            // --exclude-empty
+}
+
+// selectCollections returns the collections of dbName that pass every rule,
+// in their original order, logging why each other one is skipped (except
+// those left out by --include). Emptiness is judged by
+// EstimatedDocumentCount (collection metadata, no scan).
+func selectCollections(ctx context.Context, db *mongo.Database, colls []string, sel collSelector) ([]string, error) {
+	dbName := db.Name()
+	out := make([]string, 0, len(colls))
+	for _, collName := range colls {
+		if sel.include != nil && !sel.include[collName] {
+			continue
+		}
+		if sel.exclude[collName] {
+			fmt.Printf("Skipping excluded collection: %s\n", collName)
+			continue
+		}
+		if sel.excludeNS[dbName+"."+collName] {
+			fmt.Printf("Skipping excluded namespace: %s.%s\n", dbName, collName)
+			continue
+		}
+		if sel.skipEmpty {
+			n, err := db.Collection(collName).EstimatedDocumentCount(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("count %s: %w", collName, err)
+			}
+			if n == 0 {
+				fmt.Printf("Skipping empty collection: %s\n", collName)
+				continue
+			}
+		}
+		if sel.minBytes > 0 || sel.maxBytes > 0 {
+			size, err := collStorageSize(ctx, db, collName)
+			if err != nil {
+				return nil, fmt.Errorf("collStats %s: %w", collName, err)
+			}
+			switch {
+			case size < sel.minBytes:
+				fmt.Printf("Skipping %s: storage size %s is below --exclude-smaller-than %s\n", collName, formatBytes(size), formatBytes(sel.minBytes))
+				continue
+			case sel.maxBytes > 0 && size > sel.maxBytes:
+				fmt.Printf("Skipping %s: storage size %s is above --exclude-larger-than %s\n", collName, formatBytes(size), formatBytes(sel.maxBytes))
+				continue
+			}
+			fmt.Printf("Including %s: storage size %s\n", collName, formatBytes(size))
+		}
+		out = append(out, collName)
+	}
+	return out, nil
+}
+
+// systemDatabases are left out of --all-databases unless --include-system
+// is given.
+var systemDatabases = map[string]bool{"admin": true, "local": true, "config": true}
+
+// backupDatabases returns the databases --all-databases backs up, sorted by
+// name.
+func backupDatabases(ctx context.Context, client *mongo.Client, includeSystem bool) ([]string, error) {
+	names, err := client.ListDatabaseNames(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("list databases: %w", err)
+	}
+	out := make([]string, 0, len(names))
+	for _, n := range names {
+		if systemDatabases[n] && !includeSystem {
+			continue
+		}
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out, nil
+}
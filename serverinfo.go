@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ServerInfo describes the server a backup was taken from.
+type ServerInfo struct {
+	Version  string `json:"version"`
+	Topology string `json:"topology"` // standalone, replicaSet or sharded
+	Host     string `json:"host,omitempty"`
+	SetName  string `json:"setName,omitempty"`
+}
+
+// serverInfo gathers buildInfo and hello once per run.
+func serverInfo(ctx context.Context, db *mongo.Database) (*ServerInfo, error) {
+	var build struct {
+		Version string `bson:"version"`
+	}
+	if err := db.RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&build); err != nil {
+		return nil, fmt.Errorf("buildInfo: %w", err)
+	}
+	var hello struct {
+		Msg     string `bson:"msg"`
+		SetName string `bson:"setName"`
+		Me      string `bson:"me"`
+	}
+	if err := db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return nil, fmt.Errorf("hello: %w", err)
+	}
+	info := &ServerInfo{Version: build.Version, Topology: "standalone", Host: hello.Me, SetName: hello.SetName}
+	switch {
+	case hello.Msg == "isdbgrid":
+		info.Topology = "sharded"
+	case hello.SetName != "":
+		info.Topology = "replicaSet"
+	}
+	return info, nil
+}
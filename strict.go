@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// checkCanonical reports the first relaxed-only construct of one Extended
+// JSON document, for restore --strict:
+//
+//   - a bare number, whose BSON type (int32, int64 or double) relaxed
+//     parsing can only guess from its value;
+//   - a $date given as an ISO-8601 string or a number rather than
+//     {"$numberLong": "..."};
+//   - the legacy {"$binary": "...", "$type": "..."} and
+//     {"$regex": "...", "$options": "..."} forms.
+//
+// The numbers of $timestamp, $minKey and $maxKey are canonical.
+func checkCanonical(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	return canonicalValue(v, "")
+}
+
+func canonicalValue(v interface{}, path string) error {
+	switch x := v.(type) {
+	case json.Number:
+		return fmt.Errorf("bare number %s at %s (canonical form is $numberInt, $numberLong or $numberDouble)", x, path)
+	case []interface{}:
+		for i, e := range x {
+			if err := canonicalValue(e, joinPath(path, strconv.Itoa(i))); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		if len(x) == 1 {
+			if _, ok := x["$timestamp"]; ok {
+				return nil
+			}
+			if _, ok := x["$minKey"]; ok {
+				return nil
+			}
+			if _, ok := x["$maxKey"]; ok {
+				return nil
+			}
+		}
+		if d, ok := x["$date"]; ok {
+			if m, ok := d.(map[string]interface{}); ok && len(m) == 1 {
+				if _, ok := m["$numberLong"].(string); ok {
+					return nil
+				}
+			}
+			return fmt.Errorf("relaxed $date at %s (canonical form is {\"$date\": {\"$numberLong\": \"...\"}})", path)
+		}
+		if _, ok := x["$binary"].(string); ok {
+			return fmt.Errorf("legacy $binary at %s (canonical form is {\"$binary\": {\"base64\": ..., \"subType\": ...}})", path)
+		}
+		if _, ok := x["$regex"].(string); ok {
+			if _, ok := x["$options"]; ok {
+				return fmt.Errorf("legacy $regex at %s (canonical form is $regularExpression)", path)
+			}
+		}
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys) // report the same field on every run
+		for _, k := range keys {
+			if err := canonicalValue(x[k], joinPath(path, k)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
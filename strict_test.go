@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckCanonical(t *testing.T) {
+	tests := []struct {
+		doc     string
+		wantErr string // "" = canonical
+	}{
+		{`{"_id":{"$oid":"65a000000000000000000001"},"n":{"$numberInt":"42"},"big":{"$numberLong":"42"},"f":{"$numberDouble":"1.5"}}`, ""},
+		{`{"at":{"$date":{"$numberLong":"1700000000000"}},"ts":{"$timestamp":{"t":1700000000,"i":1}}}`, ""},
+		{`{"lo":{"$minKey":1},"hi":{"$maxKey":1},"ok":true,"s":"5","nil":null}`, ""},
+		{`{"bin":{"$binary":{"base64":"AQI=","subType":"00"}},"re":{"$regularExpression":{"pattern":"^a","options":"i"}}}`, ""},
+		{`{"n":42}`, "bare number 42 at n"},
+		{`{"profile":{"age":40.5}}`, "bare number 40.5 at profile.age"},
+		{`{"tags":["a",{"w":3}]}`, "bare number 3 at tags.1.w"},
+		{`{"at":{"$date":"2024-01-31T00:00:00Z"}}`, "relaxed $date at at"},
+		{`{"at":{"$date":1700000000000}}`, "relaxed $date at at"},
+		{`{"bin":{"$binary":"AQI=","$type":"00"}}`, "legacy $binary at bin"},
+		{`{"re":{"$regex":"^a","$options":"i"}}`, "legacy $regex at re"},
+	}
+	for _, tt := range tests {
+		err := checkCanonical([]byte(tt.doc))
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("checkCanonical(%s): %v", tt.doc, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("checkCanonical(%s) = %v, want an error containing %q", tt.doc, err, tt.wantErr)
+		}
+	}
+}
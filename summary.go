@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// runSummary is the --summary-json file: the outcome of a backup run in a
+// small, stable shape for CI checks. Unlike the manifest it is also written
+// when the run fails. The same document is what --notify-webhook posts.
+type runSummary struct {
+	Success     bool             `json:"success"`
+	DB          string           `json:"db"`
+	Output      string           `json:"output"`
+	StartedAt   time.Time        `json:"startedAt"`
+	DurationMS  int64            `json:"durationMs"`
+	Collections map[string]int64 `json:"collections"`
+	TotalDocs   int64            `json:"totalDocs"`
+	TotalBytes  int64            `json:"totalBytes"`
+	Errors      []string         `json:"errors"`
+	Skipped     []string         `json:"skipped,omitempty"`
+	Stopped     bool             `json:"stopped,omitempty"` // cut short by --max-runtime
+
+	path    string // "" = no file, only the webhook
+	webhook *webhook
+}
+
+func newRunSummary(path string, hook *webhook, db, output string, startedAt time.Time) *runSummary {
+	if path == "" && hook == nil {
+		return nil
+	}
+	return &runSummary{
+		DB:          db,
+		Output:      output,
+		StartedAt:   startedAt.UTC(),
+		Collections: map[string]int64{},
+		Errors:      []string{},
+		path:        path,
+		webhook:     hook,
+	}
+}
+
+func (s *runSummary) add(entry CollectionManifest) {
+	if s == nil {
+		return
+	}
+	s.Collections[entry.Name] = entry.Docs
+	s.TotalDocs += entry.Docs
+	s.TotalBytes += entry.written
+}
+
+func (s *runSummary) addError(err error) {
+	if s == nil {
+		return
+	}
+	s.Errors = append(s.Errors, err.Error())
+}
+
+func (s *runSummary) skip(colls []string) {
+	if s == nil {
+		return
+	}
+	s.Skipped = append(s.Skipped, colls...)
+}
+
+// stop marks a run cut short by --max-runtime. It is not a success, though
+// every collection it wrote is complete.
+func (s *runSummary) stop() {
+	if s == nil {
+		return
+	}
+	s.Stopped = true
+}
+
+// write records the final outcome. Failures to write are only warned about,
+// so they never mask the backup's own result.
+func (s *runSummary) write(success bool) {
+	if s == nil {
+		return
+	}
+	s.Success = success
+	s.DurationMS = time.Since(s.StartedAt).Milliseconds()
+	if s.path == "" {
+		return
+	}
+	if err := writeJSONFile(s.path, s); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: summary file: %v\n", err)
+	}
+}
+
+// notify posts the summary to --notify-webhook. It is separate from write so
+// a run notifies once, after its last step (the post-backup hook) decided
+// the outcome.
+func (s *runSummary) notify() {
+	if s == nil || s.webhook == nil {
+		return
+	}
+	if err := s.webhook.post(s); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: webhook notification failed: %v\n", err)
+		return
+	}
+	fmt.Println("Notified webhook.")
+}
+
+// partialRun is what an interrupted or time-capped run got done, printed
+// with --summary-on-signal.
+type partialRun struct {
+	reason     string
+	elapsed    time.Duration
+	done       []CollectionManifest
+	partial    []CollectionManifest // collections cut off mid-write
+	notStarted []string
+}
+
+func (p partialRun) print(w io.Writer) {
+	var docs, bytes int64
+	names := make([]string, 0, len(p.done))
+	for _, c := range p.done {
+		docs += c.Docs
+		bytes += c.written
+		names = append(names, c.Name)
+	}
+	cut := make([]string, 0, len(p.partial))
+	for _, c := range p.partial {
+		docs += c.Docs
+		bytes += c.written
+		cut = append(cut, fmt.Sprintf("%s (%d documents)", c.Name, c.Docs))
+	}
+	total := len(p.done) + len(p.partial) + len(p.notStarted)
+	fmt.Fprintf(w, "%s after %s: %d of %d collections complete, %d documents and %s written\n",
+		p.reason, p.elapsed.Round(time.Millisecond), len(p.done), total, docs, formatBytes(bytes))
+	if len(names) > 0 {
+		fmt.Fprintf(w, "  completed:   %s\n", strings.Join(names, ", "))
+	}
+	if len(cut) > 0 {
+		fmt.Fprintf(w, "  partial:     %s\n", strings.Join(cut, ", "))
+	}
+	if len(p.notStarted) > 0 {
+		fmt.Fprintf(w, "  not started: %s\n", strings.Join(p.notStarted, ", "))
+	}
+}
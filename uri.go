@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+)
+
+// validateURI checks a connection string before any connection attempt and
+// explains which component is wrong, rather than surfacing a generic driver
+// error after a server selection timeout.
+func validateURI(uri string) (*connstring.ConnString, error) {
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return nil, errors.New("invalid URI: missing scheme, it must start with mongodb:// or mongodb+srv://")
+	}
+	if scheme != "mongodb" && scheme != "mongodb+srv" {
+		return nil, fmt.Errorf("invalid URI: scheme %q is not supported (use mongodb:// or mongodb+srv://)", scheme)
+	}
+
+	hostPart := rest
+	if i := strings.IndexAny(hostPart, "/?"); i >= 0 {
+		hostPart = hostPart[:i]
+	}
+	if at := strings.LastIndex(hostPart, "@"); at >= 0 {
+		if strings.Count(hostPart, "@") > 1 {
+			return nil, errors.New("invalid URI: credentials contain an unescaped '@' (percent-encode it as %40)")
+		}
+		hostPart = hostPart[at+1:]
+	}
+	if hostPart == "" {
+		return nil, fmt.Errorf("invalid URI: no host given after %s://", scheme)
+	}
+	for _, h := range strings.Split(hostPart, ",") {
+		if err := checkHost(scheme, h); err != nil {
+			return nil, fmt.Errorf("invalid URI: %w", err)
+		}
+	}
+
+	cs, err := connstring.ParseAndValidate(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URI: %w", err)
+	}
+	return &cs, nil
+}
+
+func checkHost(scheme, h string) error {
+	if h == "" {
+		return errors.New("empty host in host list (check for a stray comma)")
+	}
+	host, port := h, ""
+	if strings.HasPrefix(h, "[") {
+		end := strings.Index(h, "]")
+		if end < 0 {
+			return fmt.Errorf("host %q: unterminated IPv6 address", h)
+		}
+		host = h[:end+1]
+		if tail := h[end+1:]; tail != "" {
+			if !strings.HasPrefix(tail, ":") {
+				return fmt.Errorf("host %q: unexpected %q after IPv6 address", h, tail)
+			}
+			port = tail[1:]
+		}
+	} else if i := strings.LastIndex(h, ":"); i >= 0 {
+		host, port = h[:i], h[i+1:]
+	}
+	if host == "" {
+		return fmt.Errorf("host %q: missing host name", h)
+	}
+	if port == "" && strings.HasSuffix(h, ":") {
+		return fmt.Errorf("host %q: empty port", h)
+	}
+	if port != "" {
+		if scheme == "mongodb+srv" {
+			return fmt.Errorf("host %q: mongodb+srv:// URIs must not specify a port", h)
+		}
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("host %q: port %q must be a number between 1 and 65535", h, port)
+		}
+	}
+	return nil
+}
+
+// describeURI summarizes a parsed URI without the password.
+func describeURI(cs *connstring.ConnString) string {
+	parts := []string{"hosts " + strings.Join(cs.Hosts, ",")}
+	if cs.Username != "" {
+		parts = append(parts, "user "+cs.Username)
+	}
+	if cs.AuthSource != "" {
+		parts = append(parts, "authSource "+cs.AuthSource)
+	}
+	if cs.Database != "" {
+		parts = append(parts, "database "+cs.Database)
+	}
+	if cs.ReplicaSet != "" {
+		parts = append(parts, "replicaSet "+cs.ReplicaSet)
+	}
+	if cs.SSLSet {
+		parts = append(parts, "tls "+strconv.FormatBool(cs.SSL))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// replaceURIPassword swaps the password in a URI's userinfo for repl. URIs
+// without a password are returned unchanged.
+func replaceURIPassword(uri, repl string) string {
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return uri
+	}
+	hostEnd := len(rest)
+	if i := strings.IndexAny(rest, "/?"); i >= 0 {
+		hostEnd = i
+	}
+	at := strings.LastIndex(rest[:hostEnd], "@")
+	if at < 0 {
+		return uri
+	}
+	user, _, hasPass := strings.Cut(rest[:at], ":")
+	if !hasPass {
+		return uri
+	}
+	return scheme + "://" + user + ":" + repl + rest[at:]
+}
+
+// uriDatabase returns the default database in a URI's path
+// (mongodb://host/mydb), or "" when there is none. It reads the raw string so
+// URIs with unexpanded ${KEY} tokens work too.
+func uriDatabase(uri string) string {
+	_, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return ""
+	}
+	_, path, ok := strings.Cut(rest, "/")
+	if !ok {
+		return ""
+	}
+	path, _, _ = strings.Cut(path, "?")
+	db, err := url.PathUnescape(path)
+	if err != nil {
+		return ""
+	}
+	return db
+}
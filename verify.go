@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// verifyCmd compares the document counts recorded in a backup's manifest with
+// the live collections, and with --deep also with the documents actually in
+// the backup files. Any mismatch makes it exit non-zero.
+func verifyCmd(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	input := fs.String("input", "", "Backup directory or merged .jsonl/.json file, optionally .gz (required)")
+	dbOverride := fs.String("db", "", "Compare against this database (default: the database the backup was taken from)")
+	uriEnv := fs.String("uri-env", "", "Read the MongoDB URI from this environment variable")
+	profile := fs.String("profile", "", "Saved connection profile to use (default: the default profile)")
+	deep := fs.Bool("deep", false, "Also re-read the backup files and count their documents")
+	timeout := fs.Duration("timeout", 5*time.Minute, "Operation timeout")
+	_ = fs.Parse(args)
+
+	if *input == "" {
+		fatal(errors.New("verify needs --input"))
+	}
+	st, err := os.Stat(*input)
+	if err != nil {
+		fatal(err)
+	}
+	isDir := st.IsDir()
+	m, err := readManifest(manifestPath(*input, isDir))
+	if errors.Is(err, os.ErrNotExist) {
+		fatal(fmt.Errorf("no manifest for %s; verify needs a backup written with a manifest", *input))
+	}
+	if err != nil {
+		fatal(err)
+	}
+	dbName := *dbOverride
+	if dbName == "" {
+		dbName = m.DB
+	}
+	cfg, err := resolveConfig(*profile, *uriEnv, dbName)
+	if err != nil {
+		fatal(err)
+	}
+	connURI, err := cfg.connectURI()
+	if err != nil {
+		fatal(err)
+	}
+
+	// A filtered backup only holds part of each collection: the recorded
+	// --query is applied to the live count, other filters cannot be.
+	liveFilter := bson.M{}
+	if m.Filters != nil {
+		if liveFilter, err = parseQuery(m.Filters.Query); err != nil {
+			fatal(fmt.Errorf("manifest query: %w", err))
+		}
+		if m.Filters.Age != nil || m.Filters.LimitTotal > 0 {
+			fmt.Fprintln(os.Stderr, "Warning: the backup was taken with --max-age or --limit-total; live counts are expected to differ")
+		}
+	}
+	if m.SinceBackup != "" {
+		fmt.Fprintln(os.Stderr, "Warning: incremental backup (--since-last-backup); live counts are expected to differ")
+	}
+
+	var fileDocs map[string]int64
+	if *deep {
+		if fileDocs, err = countBackupFiles(*input, isDir, m); err != nil {
+			fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	client, err := mongo.Connect(ctx, clientOptions(connURI))
+	if err != nil {
+		fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	db := client.Database(cfg.DB)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if *deep {
+		fmt.Fprintln(tw, "COLLECTION\tEXPECTED\tACTUAL\tFILE\tSTATUS")
+	} else {
+		fmt.Fprintln(tw, "COLLECTION\tEXPECTED\tACTUAL\tSTATUS")
+	}
+	bad := 0
+	for _, c := range m.Collections {
+		actual := "-"
+		status := "OK"
+		if c.Pipeline != nil {
+			// The recorded count is the pipeline's output, not the collection's.
+			actual = "(pipeline)"
+		} else if n, err := db.Collection(c.Name).CountDocuments(ctx, liveFilter); err != nil {
+			status = "ERROR: " + err.Error()
+		} else {
+			actual = fmt.Sprint(n)
+			if n != c.Docs {
+				status = "MISMATCH"
+			}
+		}
+		if *deep {
+			n := fileDocs[c.Name]
+			if n != c.Docs && status == "OK" {
+				status = "FILE MISMATCH"
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%s\n", c.Name, c.Docs, actual, n, status)
+		} else {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", c.Name, c.Docs, actual, status)
+		}
+		if status != "OK" {
+			bad++
+		}
+	}
+	_ = tw.Flush()
+	if bad > 0 {
+		fatal(fmt.Errorf("%d of %d collections failed verification", bad, len(m.Collections)))
+	}
+	fmt.Println("Verify OK.")
+}
+
+// countBackupFiles counts the documents per collection in the files of a
+// backup: the files (or partitions) listed in the manifest of a directory
+// backup, or the _meta collection of each document in a merged file.
+func countBackupFiles(input string, isDir bool, m Manifest) (map[string]int64, error) {
+	counts := map[string]int64{}
+	if !isDir {
+		err := readBackupFile(input, false, func(doc bson.D) error {
+			_, _, coll, err := takeMeta(doc, "_meta")
+			if err != nil {
+				return err
+			}
+			counts[coll]++
+			return nil
+		})
+		return counts, err
+	}
+	for _, c := range m.Collections {
+		for _, f := range c.dataFiles() {
+			err := readBackupFile(filepath.Join(input, f), false, func(bson.D) error {
+				counts[c.Name]++
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return counts, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// An --output-split-by-date collection whose documents were all filtered out
+// has no File and no Partitions; it must count as empty rather than open the
+// backup directory as a file.
+func TestCountBackupFilesEmptySplitCollection(t *testing.T) {
+	dir := t.TempDir()
+	line := `{"_id":{"$oid":"65a000000000000000000001"},"n":1}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "shop.orders.2024-01.jsonl"), []byte(line+line), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m := Manifest{DB: "shop", Collections: []CollectionManifest{
+		{Name: "orders", Docs: 2, Partitions: []FilePartition{{File: "shop.orders.2024-01.jsonl"}}},
+		{Name: "empty", Docs: 0},
+	}}
+	counts, err := countBackupFiles(dir, true, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["orders"] != 2 || counts["empty"] != 0 {
+		t.Errorf("counts = %v, want orders 2, empty 0", counts)
+	}
+	if files := m.Collections[1].dataFiles(); len(files) != 0 {
+		t.Errorf("dataFiles of an empty split collection = %q, want none", files)
+	}
+}